@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+)
+
+// acker groups the tasks completed successfully and acknowledges them to a
+// core.BatchAcker worker once a batch is full or the flush interval is over.
+type acker struct {
+	sync.Mutex
+	worker   core.BatchAcker
+	pending  []core.TaskMessage
+	size     int
+	interval time.Duration
+	clock    Clock
+	logger   Logger
+}
+
+// add records task as completed and acknowledges the batch once it is full.
+func (a *acker) add(task core.TaskMessage) {
+	a.Lock()
+	a.pending = append(a.pending, task)
+	if len(a.pending) < a.size {
+		a.Unlock()
+		return
+	}
+	batch := a.take()
+	a.Unlock()
+	a.ack(batch)
+}
+
+// take empties the pending batch and returns it. The caller must hold the lock.
+func (a *acker) take() []core.TaskMessage {
+	batch := a.pending
+	a.pending = nil
+	return batch
+}
+
+// flush acknowledges the pending tasks, if any.
+func (a *acker) flush() {
+	a.Lock()
+	batch := a.take()
+	a.Unlock()
+	if len(batch) > 0 {
+		a.ack(batch)
+	}
+}
+
+func (a *acker) ack(batch []core.TaskMessage) {
+	if err := a.worker.AckBatch(batch); err != nil {
+		a.logger.Errorf("acknowledge %d tasks: %s", len(batch), err.Error())
+	}
+}
+
+// run flushes the pending tasks every interval until quit is closed. It then
+// waits for idle to report that no job is running and flushes a last time.
+func (a *acker) run(quit <-chan struct{}, idle func() bool) {
+	for {
+		select {
+		case <-a.clock.After(a.interval):
+			a.flush()
+			continue
+		case <-quit:
+		}
+		break
+	}
+
+	for !idle() {
+		<-a.clock.After(10 * time.Millisecond)
+	}
+	a.flush()
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type batchAckWorker struct {
+	*Ring
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (w *batchAckWorker) AckBatch(tasks []core.TaskMessage) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	batch := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		batch = append(batch, string(task.Payload()))
+	}
+	w.batches = append(w.batches, batch)
+	return nil
+}
+
+func (w *batchAckWorker) acked() [][]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([][]string(nil), w.batches...)
+}
+
+func TestBatchAck(t *testing.T) {
+	clock := newFakeClock()
+	w := &batchAckWorker{
+		Ring: NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			if string(m.Payload()) == "fail" {
+				return context.DeadlineExceeded
+			}
+			return nil
+		})),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithClock(clock),
+		WithAckBatchSize(3),
+		WithAckFlushInterval(time.Minute),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for _, body := range []string{"a", "b", "c", "fail", "d", "e", "f", "g"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 7 && q.FailureTasks() == 1
+	}, time.Second, time.Millisecond)
+
+	// full batches are acknowledged at once, failed tasks never are
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"d", "e", "f"}}, w.acked())
+
+	// the rest waits for the flush interval
+	assert.Eventually(t, func() bool {
+		clock.Advance(time.Minute)
+		return len(w.acked()) == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"g"}, w.acked()[2])
+
+	// the last tasks are acknowledged on shutdown
+	for _, body := range []string{"h", "i"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 9
+	}, time.Second, time.Millisecond)
+	q.Release()
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"d", "e", "f"}, {"g"}, {"h", "i"}}, w.acked())
+}
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/golang-queue/queue/core"
+)
+
+// backpressure samples the usage of a worker and reports when it stays
+// above a share of the capacity for a whole window.
+type backpressure struct {
+	fn        func(usage, capacity int)
+	window    time.Duration
+	threshold float64
+	clock     Clock
+}
+
+// run samples the worker until quit is closed. It returns immediately when
+// the worker can't report its usage or has no capacity limit.
+func (b *backpressure) run(w core.Worker, quit <-chan struct{}) {
+	u, ok := w.(core.UsageReporter)
+	if !ok {
+		return
+	}
+	c, ok := w.(core.CapacityReporter)
+	if !ok || c.Capacity() <= 0 {
+		return
+	}
+
+	var since time.Time
+	for {
+		select {
+		case <-quit:
+			return
+		case <-b.clock.After(b.window / 10):
+		}
+
+		usage, capacity := u.Usage(), c.Capacity()
+		if float64(usage) < b.threshold*float64(capacity) {
+			since = time.Time{}
+			continue
+		}
+
+		now := b.clock.Now()
+		if since.IsZero() {
+			since = now
+			continue
+		}
+		if now.Sub(since) >= b.window {
+			b.fn(usage, capacity)
+			since = now
+		}
+	}
+}
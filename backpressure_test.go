@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackpressureCallback(t *testing.T) {
+	var calls, lastUsage, lastCapacity int32
+	q, err := NewQueue(
+		WithWorker(NewRing(WithQueueSize(10))),
+		WithBackpressureCallback(func(usage, capacity int) {
+			atomic.StoreInt32(&lastUsage, int32(usage))
+			atomic.StoreInt32(&lastCapacity, int32(capacity))
+			atomic.AddInt32(&calls, 1)
+		}),
+		WithBackpressureWindow(50*time.Millisecond),
+		WithBackpressureThreshold(0.8),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	// no worker drains the ring
+	q.UpdateWorkerCount(0)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) > 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(10), atomic.LoadInt32(&lastUsage))
+	assert.Equal(t, int32(10), atomic.LoadInt32(&lastCapacity))
+
+	q.UpdateWorkerCount(2)
+	q.Release()
+}
+
+func TestBackpressureLightLoad(t *testing.T) {
+	var calls int32
+	q, err := NewQueue(
+		WithWorker(NewRing(WithQueueSize(10))),
+		WithBackpressureCallback(func(usage, capacity int) {
+			atomic.AddInt32(&calls, 1)
+		}),
+		WithBackpressureWindow(20*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	q.UpdateWorkerCount(0)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	q.UpdateWorkerCount(2)
+	q.Release()
+}
+
+func TestBackpressureUnboundedWorker(t *testing.T) {
+	var calls int32
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithBackpressureCallback(func(usage, capacity int) {
+			atomic.AddInt32(&calls, 1)
+		}),
+		WithBackpressureWindow(20*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	q.UpdateWorkerCount(0)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	q.UpdateWorkerCount(2)
+	q.Release()
+}
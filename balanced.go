@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+)
+
+var _ core.Worker = (*BalancedWorker)(nil)
+
+// BalancedWorker spreads queued tasks over several workers round-robin and
+// consumes from all of them fairly. A message is run by the worker it was
+// queued to; other task types are run by the first worker. Workers given a
+// weight with Weighted are picked at random in proportion to their weight
+// instead.
+type BalancedWorker struct {
+	*workerSet
+	queueMu   sync.Mutex
+	queueNext int        // queueNext is the worker the next task is queued to.
+	weights   []int      // weights of the workers, nil for round-robin.
+	total     int        // total is the sum of the weights.
+	rand      *rand.Rand // rand picks the weighted worker.
+}
+
+// weightedWorker carries the weight of a worker to NewBalancedWorker.
+type weightedWorker struct {
+	core.Worker
+	weight int
+}
+
+// Weighted gives worker a weight for NewBalancedWorker, it receives
+// proportionally more tasks than workers of a lower weight. Workers passed
+// without a weight count as weight 1, as do weights below 1.
+func Weighted(worker core.Worker, weight int) core.Worker {
+	return &weightedWorker{Worker: worker, weight: weight}
+}
+
+// NewBalancedWorker returns a worker balancing tasks across workers.
+func NewBalancedWorker(workers ...core.Worker) *BalancedWorker {
+	w := &BalancedWorker{
+		workerSet: &workerSet{workers: make([]core.Worker, 0, len(workers))},
+	}
+
+	weights := make([]int, 0, len(workers))
+	weighted := false
+	for _, worker := range workers {
+		weight := 1
+		if ww, ok := worker.(*weightedWorker); ok {
+			worker = ww.Worker
+			if ww.weight > 1 {
+				weight = ww.weight
+			}
+		}
+		weighted = weighted || weight != 1
+		w.workers = append(w.workers, worker)
+		weights = append(weights, weight)
+		w.total += weight
+	}
+	if weighted {
+		w.weights = weights
+		w.rand = rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+	}
+
+	return w
+}
+
+// Queue adds task to the next worker in turn, or to a random one by weight.
+// When that worker rejects it the following ones are tried, the last error
+// is returned if none accepts it.
+func (w *BalancedWorker) Queue(task core.TaskMessage) error {
+	w.queueMu.Lock()
+	start := w.pick()
+	w.queueMu.Unlock()
+
+	var err error
+	for i := range w.workers {
+		worker := w.workers[(start+i)%len(w.workers)]
+		if err = worker.Queue(task); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// pick returns the index of the worker the next task is queued to. The
+// caller must hold queueMu.
+func (w *BalancedWorker) pick() int {
+	if w.weights == nil {
+		i := w.queueNext
+		w.queueNext = (w.queueNext + 1) % len(w.workers)
+		return i
+	}
+
+	n := w.rand.Intn(w.total)
+	for i, weight := range w.weights {
+		if n < weight {
+			return i
+		}
+		n -= weight
+	}
+	return len(w.weights) - 1
+}
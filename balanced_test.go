@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalancedWorker(t *testing.T) {
+	total := 30
+	var handled [3]int32
+	rings := make([]core.Worker, 0, len(handled))
+	for i := range handled {
+		i := i
+		rings = append(rings, NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			atomic.AddInt32(&handled[i], 1)
+			return nil
+		})))
+	}
+
+	q, err := NewQueue(
+		WithWorker(NewBalancedWorker(rings...)),
+		WithWorkerCount(4),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == uint64(total)
+	}, time.Second, 5*time.Millisecond)
+	q.Release()
+
+	for i := range handled {
+		assert.Equal(t, int32(total/len(handled)), atomic.LoadInt32(&handled[i]))
+	}
+}
+
+func TestBalancedWorkerSkipsFullWorker(t *testing.T) {
+	full := NewRing(WithQueueSize(1))
+	open := NewRing()
+	w := NewBalancedWorker(full, open)
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, w.Queue(mockMessage{message: "foo"}))
+	}
+	task, err := full.Request()
+	assert.NoError(t, err)
+	assert.NotNil(t, task)
+	_, err = full.Request()
+	assert.Equal(t, ErrNoTaskInQueue, err)
+}
+
+func TestBalancedWorkerShutdown(t *testing.T) {
+	a, b := NewRing(), NewRing()
+	w := NewBalancedWorker(a, b)
+
+	assert.NoError(t, w.Shutdown())
+	assert.Equal(t, ErrQueueShutdown, a.Queue(mockMessage{}))
+	assert.Equal(t, ErrQueueShutdown, b.Queue(mockMessage{}))
+	_, err := w.Request()
+	assert.Equal(t, ErrQueueHasBeenClosed, err)
+}
+
+func TestBalancedWorkerWeighted(t *testing.T) {
+	total := 10000
+	light := NewRing()
+	heavy := NewRing()
+	plain := NewRing()
+	w := NewBalancedWorker(Weighted(light, 1), Weighted(heavy, 3), plain)
+	assert.True(t, w.has(heavy))
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, w.Queue(mockMessage{message: "foo"}))
+	}
+
+	// the workers get their share of 1/5, 3/5 and 1/5 within tolerance
+	assert.InDelta(t, 0.2, float64(light.Usage())/float64(total), 0.03)
+	assert.InDelta(t, 0.6, float64(heavy.Usage())/float64(total), 0.03)
+	assert.InDelta(t, 0.2, float64(plain.Usage())/float64(total), 0.03)
+	assert.Equal(t, total, light.Usage()+heavy.Usage()+plain.Usage())
+}
+
+func TestBalancedWorkerCopiedMessages(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[string][]string)
+	record := func(name string) Option {
+		return WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			mu.Lock()
+			got[name] = append(got[name], string(m.Payload()))
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	// the workers hand out new messages, not the ones queued
+	first := newFinishWorker(NewRing(record("first")))
+	second := newFinishWorker(NewRing(record("second")))
+	w := NewBalancedWorker(first, second)
+	q, err := NewQueue(WithWorker(w), WithLogger(NewEmptyLogger()))
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	assert.NoError(t, q.Queue(mockMessage{message: "bar"}))
+	q.Start()
+	q.Release()
+
+	assert.Equal(t, []string{"foo"}, got["first"])
+	assert.Equal(t, []string{"bar"}, got["second"])
+	assert.Equal(t, []error{nil}, first.outcomes("foo"))
+	assert.Equal(t, []error{nil}, second.outcomes("bar"))
+	assert.Nil(t, first.outcomes("bar"))
+
+	// no owner is left behind
+	w.owners.Range(func(k, v any) bool {
+		t.Errorf("owner left for %v", k)
+		return true
+	})
+}
@@ -130,6 +130,83 @@ func BenchmarkRingWithTask(b *testing.B) {
 	)
 
 	for n := 0; n < b.N; n++ {
-		_ = q.run(&task)
+		_ = q.run(context.Background(), &task)
+	}
+}
+
+func BenchmarkDispatch(b *testing.B) {
+	q, _ := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(4),
+		WithLogger(emptyLogger{}),
+	)
+	task := func(context.Context) error {
+		return nil
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_ = q.QueueTask(task)
+	}
+	_ = q.Start()
+	q.Release()
+}
+
+func BenchmarkMetrics(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Enabled"},
+		{name: "Disabled", opts: []Option{WithMetricsDisabled()}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			q, _ := NewQueue(append([]Option{
+				WithWorker(NewRing()),
+				WithLogger(emptyLogger{}),
+			}, bm.opts...)...)
+			task := func(context.Context) error {
+				return nil
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				_ = q.QueueTask(task)
+			}
+			_ = q.Start()
+			q.Release()
+		})
+	}
+}
+
+func BenchmarkInlineExecution(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		timeout time.Duration
+		opts    []Option
+	}{
+		{name: "Goroutine", timeout: time.Minute},
+		{name: "Inline", opts: []Option{WithInlineExecution()}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			q, _ := NewQueue(append([]Option{
+				WithWorker(NewRing()),
+				WithLogger(emptyLogger{}),
+			}, bm.opts...)...)
+			task := job.Message{
+				Timeout: bm.timeout,
+				Task: func(_ context.Context) error {
+					return nil
+				},
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				_ = q.run(context.Background(), &task)
+			}
+		})
 	}
 }
@@ -0,0 +1,211 @@
+// Package boltdb provides a durable worker backed by an embedded bolt
+// database, for single-node queues that must survive a restart.
+package boltdb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang-queue/queue"
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	_ core.Worker      = (*Worker)(nil)
+	_ core.LocalWorker = (*Worker)(nil)
+	_ core.Finisher    = (*Worker)(nil)
+)
+
+// Worker stores encoded job messages in a bolt database. Messages are handed
+// out in the order they were queued and deleted once the queue is done with
+// them, so the ones still unfinished when the process stops are delivered
+// again after the database is reopened. A message that failed is moved to
+// the tail of the database, to be handed out again after the others.
+type Worker struct {
+	sync.Mutex
+	db       *bolt.DB
+	opts     options
+	inflight map[uint64]struct{}     // keys handed out by Request and not finished yet
+	pending  map[*job.Message]uint64 // messages handed out by Request and their key
+	next     uint64                  // keys below next are all in flight or deleted
+	stopFlag int32
+}
+
+// NewWorker opens, or creates, the bolt database at path.
+func NewWorker(path string, opts ...Option) (*Worker, error) {
+	o := newOptions(opts...)
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(o.bucket))
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Worker{
+		db:       db,
+		opts:     o,
+		inflight: make(map[uint64]struct{}),
+		pending:  make(map[*job.Message]uint64),
+	}, nil
+}
+
+// Run processes the task. The message stays in the database until the queue
+// finishes it, see Finish.
+func (w *Worker) Run(ctx context.Context, task core.TaskMessage) error {
+	return w.opts.runFunc(ctx, task)
+}
+
+// Finish deletes the message handed out by Request from the database. A
+// message that failed is moved to the tail instead, so that it doesn't hold
+// up the others.
+func (w *Worker) Finish(task core.TaskMessage, err error) {
+	m, ok := task.(*job.Message)
+	if !ok {
+		return
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	key, ok := w.pending[m]
+	if !ok {
+		return
+	}
+
+	// keep the key in flight until the change is committed so that
+	// Request can't hand it out again in between
+	if uerr := w.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(w.opts.bucket))
+		if v := b.Get(itob(key)); v != nil && err != nil {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			// the value is only valid until the record is deleted
+			if err := b.Put(itob(seq), append([]byte(nil), v...)); err != nil {
+				return err
+			}
+		}
+		return b.Delete(itob(key))
+	}); uerr != nil {
+		w.opts.logger.Errorf("finish message %d: %s", key, uerr.Error())
+		return
+	}
+	delete(w.pending, m)
+	delete(w.inflight, key)
+}
+
+// Shutdown stops handing out messages. The messages left in the database
+// are kept for the next run.
+func (w *Worker) Shutdown() error {
+	if !atomic.CompareAndSwapInt32(&w.stopFlag, 0, 1) {
+		return queue.ErrQueueShutdown
+	}
+	return nil
+}
+
+// Local reports false, tasks are stored encoded and may be handled by
+// another process opening the database.
+func (w *Worker) Local() bool {
+	return false
+}
+
+// Close closes the database. Call it once the queue has been released.
+func (w *Worker) Close() error {
+	return w.db.Close()
+}
+
+// Queue appends the encoded task to the database.
+func (w *Worker) Queue(task core.TaskMessage) error {
+	if atomic.LoadInt32(&w.stopFlag) == 1 {
+		return queue.ErrQueueShutdown
+	}
+	if m, ok := task.(*job.Message); ok && m.Task != nil {
+		return queue.ErrTaskNotSerializable
+	}
+
+	return w.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(w.opts.bucket))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(seq), task.Bytes())
+	})
+}
+
+// Request returns the oldest message that is not being processed.
+func (w *Worker) Request() (core.TaskMessage, error) {
+	if atomic.LoadInt32(&w.stopFlag) == 1 {
+		return nil, queue.ErrQueueHasBeenClosed
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	var m *job.Message
+	var corrupt []uint64
+	err := w.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(w.opts.bucket)).Cursor()
+		for k, v := c.Seek(itob(w.next)); k != nil; k, v = c.Next() {
+			key := binary.BigEndian.Uint64(k)
+			if _, ok := w.inflight[key]; ok {
+				continue
+			}
+
+			msg := &job.Message{}
+			if err := json.Unmarshal(v, msg); err != nil {
+				w.opts.logger.Errorf("decode message %d: %s", key, err.Error())
+				corrupt = append(corrupt, key)
+				continue
+			}
+
+			w.inflight[key] = struct{}{}
+			w.pending[msg] = key
+			w.next = key + 1
+			m = msg
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// drop the corrupt records instead of blocking the queue on them
+	if len(corrupt) > 0 {
+		if err := w.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(w.opts.bucket))
+			for _, key := range corrupt {
+				if err := b.Delete(itob(key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if m == nil {
+		return nil, queue.ErrNoTaskInQueue
+	}
+
+	return m, nil
+}
+
+// itob encodes v as a big endian key so that keys sort in queue order.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,286 @@
+package boltdb
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue"
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+	"github.com/golang-queue/queue/queuetest"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+type mockMessage struct {
+	message string
+}
+
+func (m mockMessage) Bytes() []byte {
+	return []byte(m.message)
+}
+
+func (m mockMessage) Payload() []byte {
+	return []byte(m.message)
+}
+
+func queueMessages(t *testing.T, w *Worker, bodies ...string) {
+	for _, body := range bodies {
+		m := job.NewMessage(mockMessage{message: body})
+		assert.NoError(t, w.Queue(&m))
+	}
+}
+
+func TestPersistAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	w, err := NewWorker(path)
+	assert.NoError(t, err)
+	queueMessages(t, w, "foo", "bar", "baz")
+	assert.NoError(t, w.Close())
+
+	w, err = NewWorker(path)
+	assert.NoError(t, err)
+	defer w.Close()
+	for _, body := range []string{"foo", "bar", "baz"} {
+		task, err := w.Request()
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(task.Payload()))
+	}
+	_, err = w.Request()
+	assert.Equal(t, queue.ErrNoTaskInQueue, err)
+}
+
+func TestRedeliverAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	w, err := NewWorker(path, WithRunFunc(func(context.Context, core.TaskMessage) error {
+		return nil
+	}))
+	assert.NoError(t, err)
+	queueMessages(t, w, "foo", "bar")
+
+	// foo is finished, bar is handed out but the process dies before it
+	// finishes
+	foo, err := w.Request()
+	assert.NoError(t, err)
+	assert.NoError(t, w.Run(context.Background(), foo))
+	w.Finish(foo, nil)
+	bar, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", string(bar.Payload()))
+	_, err = w.Request()
+	assert.Equal(t, queue.ErrNoTaskInQueue, err)
+	assert.NoError(t, w.Close())
+
+	w, err = NewWorker(path)
+	assert.NoError(t, err)
+	defer w.Close()
+	task, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", string(task.Payload()))
+	_, err = w.Request()
+	assert.Equal(t, queue.ErrNoTaskInQueue, err)
+}
+
+func TestRejectTaskFunc(t *testing.T) {
+	w, err := NewWorker(filepath.Join(t.TempDir(), "queue.db"))
+	assert.NoError(t, err)
+	defer w.Close()
+
+	task := job.NewTask(func(context.Context) error { return nil })
+	assert.Equal(t, queue.ErrTaskNotSerializable, w.Queue(&task))
+
+	// the queue refuses it before it reaches the worker
+	q, err := queue.NewQueue(
+		queue.WithWorker(w),
+		queue.WithLogger(queue.NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, queue.ErrTaskNotSerializable, q.QueueTask(func(context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+}
+
+func TestWithQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	var mu sync.Mutex
+	var got []string
+	w, err := NewWorker(path, WithRunFunc(func(ctx context.Context, m core.TaskMessage) error {
+		mu.Lock()
+		got = append(got, string(m.Payload()))
+		mu.Unlock()
+		return nil
+	}))
+	assert.NoError(t, err)
+
+	q, err := queue.NewQueue(
+		queue.WithWorker(w),
+		queue.WithWorkerCount(1),
+		queue.WithPollInterval(10*time.Millisecond),
+		queue.WithLogger(queue.NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	for _, body := range []string{"foo", "bar"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 2
+	}, time.Second, 5*time.Millisecond)
+	q.Release()
+	assert.NoError(t, w.Close())
+	assert.Equal(t, []string{"foo", "bar"}, got)
+
+	// acknowledged messages are gone
+	w, err = NewWorker(path)
+	assert.NoError(t, err)
+	defer w.Close()
+	_, err = w.Request()
+	assert.Equal(t, queue.ErrNoTaskInQueue, err)
+}
+
+func TestConformance(t *testing.T) {
+	queuetest.RunWorkerConformance(t, func() core.Worker {
+		w, err := NewWorker(filepath.Join(t.TempDir(), "queue.db"),
+			WithRunFunc(func(context.Context, core.TaskMessage) error {
+				return nil
+			}),
+		)
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			w.Close()
+		})
+		return w
+	})
+}
+
+func TestMissingRunFunc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	w, err := NewWorker(path)
+	assert.NoError(t, err)
+	queueMessages(t, w, "foo")
+
+	// without run function the message fails and is kept
+	task, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, queue.ErrMissingRunFunc, w.Run(context.Background(), task))
+	assert.NoError(t, w.Close())
+
+	w, err = NewWorker(path)
+	assert.NoError(t, err)
+	defer w.Close()
+	task, err = w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(task.Payload()))
+}
+
+func TestRedeliverFailed(t *testing.T) {
+	errFailed := errors.New("failed")
+	w, err := NewWorker(filepath.Join(t.TempDir(), "queue.db"),
+		WithRunFunc(func(ctx context.Context, m core.TaskMessage) error {
+			return errFailed
+		}),
+	)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	queueMessages(t, w, "foo", "bar", "baz")
+
+	// foo stays in flight until the queue finishes it
+	foo, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, errFailed, w.Run(context.Background(), foo))
+	bar, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", string(bar.Payload()))
+
+	// once it failed for good it is handed out again after the others
+	w.Finish(foo, errFailed)
+	for _, want := range []string{"baz", "foo"} {
+		task, err := w.Request()
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(task.Payload()))
+	}
+	assert.Len(t, w.pending, 3)
+	_, err = w.Request()
+	assert.Equal(t, queue.ErrNoTaskInQueue, err)
+	assert.NoError(t, w.db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 3, tx.Bucket([]byte(defaultBucket)).Stats().KeyN)
+		return nil
+	}))
+}
+
+func TestFinishSkipped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	var runs int32
+	w, err := NewWorker(path, WithRunFunc(func(context.Context, core.TaskMessage) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}))
+	assert.NoError(t, err)
+
+	q, err := queue.NewQueue(
+		queue.WithWorker(w),
+		queue.WithPollInterval(10*time.Millisecond),
+		queue.WithLogger(queue.NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}, job.AllowOption{
+		MaxAge: job.Time(time.Nanosecond),
+	}))
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.ExpiredTasks() == 1
+	}, time.Second, 5*time.Millisecond)
+	q.Release()
+	assert.NoError(t, w.Close())
+	assert.Zero(t, atomic.LoadInt32(&runs))
+
+	// the expired message never ran and is gone all the same
+	w, err = NewWorker(path)
+	assert.NoError(t, err)
+	defer w.Close()
+	_, err = w.Request()
+	assert.Equal(t, queue.ErrNoTaskInQueue, err)
+}
+
+func TestDropCorrupt(t *testing.T) {
+	w, err := NewWorker(filepath.Join(t.TempDir(), "queue.db"), WithLogger(queue.NewEmptyLogger()))
+	assert.NoError(t, err)
+	defer w.Close()
+
+	assert.NoError(t, w.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(defaultBucket))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(seq), []byte("{not json"))
+	}))
+	queueMessages(t, w, "foo")
+
+	task, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(task.Payload()))
+	assert.NoError(t, w.db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 1, tx.Bucket([]byte(defaultBucket)).Stats().KeyN)
+		return nil
+	}))
+}
@@ -0,0 +1,22 @@
+module github.com/golang-queue/queue/boltdb
+
+go 1.22
+
+require (
+	github.com/golang-queue/queue v0.2.1-0.20261016134020-8983ea2b7751
+	github.com/stretchr/testify v1.10.0
+	go.etcd.io/bbolt v1.3.11
+	go.uber.org/goleak v1.3.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/jpillora/backoff v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// builds against the local tree until the queue module is tagged, drop
+// before releasing
+replace github.com/golang-queue/queue => ../
@@ -0,0 +1,55 @@
+package boltdb
+
+import (
+	"context"
+
+	"github.com/golang-queue/queue"
+	"github.com/golang-queue/queue/core"
+)
+
+var defaultBucket = "queue"
+
+// An Option configures the bolt worker.
+type Option func(*options)
+
+type options struct {
+	runFunc func(context.Context, core.TaskMessage) error
+	logger  queue.Logger
+	bucket  string
+}
+
+// WithRunFunc set the function processing the tasks. Without it the
+// messages fail with queue.ErrMissingRunFunc and stay in the database.
+func WithRunFunc(fn func(context.Context, core.TaskMessage) error) Option {
+	return func(o *options) {
+		o.runFunc = fn
+	}
+}
+
+// WithLogger set custom logger
+func WithLogger(l queue.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithBucket set the bucket name the messages are stored in
+func WithBucket(name string) Option {
+	return func(o *options) {
+		o.bucket = name
+	}
+}
+
+func newOptions(opts ...Option) options {
+	o := options{
+		runFunc: func(context.Context, core.TaskMessage) error { return queue.ErrMissingRunFunc },
+		logger:  queue.NewLogger(),
+		bucket:  defaultBucket,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit breaker set by WithCircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every job run.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails the jobs with ErrCircuitOpen without running them.
+	CircuitOpen
+	// CircuitHalfOpen lets a single job run to probe for recovery.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// breaker opens after threshold consecutive failed attempts and lets a
+// probe through once cooldown has elapsed. A probe that doesn't report
+// within cooldown, e.g. because it hangs or its job was dropped, counts as
+// failed.
+type breaker struct {
+	sync.Mutex
+	clock     Clock
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     CircuitState
+	openedAt  time.Time
+	probing   bool
+	probeAt   time.Time // when the probe was let through
+}
+
+func newBreaker(clock Clock, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		clock:     clock,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether an attempt may run. Once the cooldown is over, the
+// first caller gets to probe and the others are refused until it reports.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing, b.probeAt = true, b.clock.Now()
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			b.expireProbe()
+			return false
+		}
+		b.probing, b.probeAt = true, b.clock.Now()
+		return true
+	}
+	return true
+}
+
+// expireProbe opens the circuit again once the probe has run for longer
+// than cooldown without reporting. The caller must hold the lock.
+func (b *breaker) expireProbe() {
+	if b.state != CircuitHalfOpen || !b.probing || b.clock.Now().Sub(b.probeAt) < b.cooldown {
+		return
+	}
+	b.state = CircuitOpen
+	b.openedAt = b.clock.Now()
+	b.probing = false
+}
+
+// report records the outcome of an attempt allowed to run.
+func (b *breaker) report(err error) {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.state = CircuitClosed
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = b.clock.Now()
+		b.probing = false
+	}
+}
+
+func (b *breaker) current() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	b.expireProbe()
+	if b.state == CircuitOpen && b.clock.Now().Sub(b.openedAt) >= b.cooldown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
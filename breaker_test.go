@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerStates(t *testing.T) {
+	clock := newFakeClock()
+	b := newBreaker(clock, 2, time.Minute)
+	errFailed := errors.New("failed")
+
+	assert.True(t, b.allow())
+	b.report(errFailed)
+	assert.Equal(t, CircuitClosed, b.current())
+	assert.True(t, b.allow())
+	b.report(errFailed)
+	assert.Equal(t, CircuitOpen, b.current())
+	assert.False(t, b.allow())
+
+	// a single probe after the cooldown
+	clock.Advance(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, b.current())
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+
+	// a failed probe opens it again
+	b.report(errFailed)
+	assert.Equal(t, CircuitOpen, b.current())
+	assert.False(t, b.allow())
+
+	// a successful probe closes it
+	clock.Advance(time.Minute)
+	assert.True(t, b.allow())
+	b.report(nil)
+	assert.Equal(t, CircuitClosed, b.current())
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+
+	// a success resets the consecutive failures
+	b.report(errFailed)
+	b.report(nil)
+	b.report(errFailed)
+	assert.Equal(t, CircuitClosed, b.current())
+}
+
+func TestBreakerProbeTimeout(t *testing.T) {
+	clock := newFakeClock()
+	b := newBreaker(clock, 1, time.Minute)
+
+	assert.True(t, b.allow())
+	b.report(errors.New("failed"))
+	clock.Advance(time.Minute)
+	assert.True(t, b.allow())
+
+	// the probe never reports
+	clock.Advance(time.Minute - time.Second)
+	assert.Equal(t, CircuitHalfOpen, b.current())
+	assert.False(t, b.allow())
+	clock.Advance(time.Second)
+	assert.Equal(t, CircuitOpen, b.current())
+	assert.False(t, b.allow())
+
+	// the next probe gets through after another cooldown
+	clock.Advance(time.Minute)
+	assert.True(t, b.allow())
+	b.report(nil)
+	assert.Equal(t, CircuitClosed, b.current())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	healthy := false
+	var calls int
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithCircuitBreaker(3, 100*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, q.CircuitState())
+	assert.NoError(t, q.Start())
+	defer q.Release()
+
+	task := func(ctx context.Context) error {
+		calls++
+		if !healthy {
+			return errors.New("downstream unavailable")
+		}
+		return nil
+	}
+
+	// three failures open the breaker
+	for i := 0; i < 3; i++ {
+		assert.Error(t, q.QueueTaskAndWait(context.Background(), task))
+	}
+	assert.Equal(t, CircuitOpen, q.CircuitState())
+
+	// the next jobs fail at once without running
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, ErrCircuitOpen, q.QueueTaskAndWait(context.Background(), task))
+	}
+	assert.Equal(t, 3, calls)
+
+	// after the cooldown a successful probe closes the breaker
+	healthy = true
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, q.CircuitState())
+	assert.NoError(t, q.QueueTaskAndWait(context.Background(), task))
+	assert.Equal(t, CircuitClosed, q.CircuitState())
+	assert.NoError(t, q.QueueTaskAndWait(context.Background(), task))
+	assert.Equal(t, 5, calls)
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+)
+
+var (
+	_ core.Worker           = (*ChannelWorker)(nil)
+	_ core.ContextRequester = (*ChannelWorker)(nil)
+	_ core.UsageReporter    = (*ChannelWorker)(nil)
+	_ core.CapacityReporter = (*ChannelWorker)(nil)
+)
+
+// ChannelWorker is a read-only worker taking its tasks from a channel owned
+// by the caller, so that messages already flowing through a channel reach
+// the queue without being buffered twice.
+type ChannelWorker struct {
+	source   <-chan core.QueuedMessage                     // source is the channel the tasks are read from.
+	runFunc  func(context.Context, core.TaskMessage) error // runFunc is the function responsible for processing tasks.
+	stop     chan struct{}                                 // stop is closed when the worker is shut down.
+	stopOnce sync.Once                                     // stopOnce ensures the shutdown process only runs once.
+	stopFlag int32                                         // stopFlag indicates whether the worker is shut down.
+}
+
+// NewChannelWorker creates a worker handing out the messages received from
+// ch. Messages other than a *job.Message become the payload of a job message
+// with the default job options. The worker stops handing out tasks once ch is closed
+// or the worker is shut down, the messages left in ch are the caller's.
+func NewChannelWorker(ch <-chan core.QueuedMessage, opts ...Option) *ChannelWorker {
+	o := NewOptions(opts...)
+	return &ChannelWorker{
+		source:  ch,
+		runFunc: o.fn,
+		stop:    make(chan struct{}),
+	}
+}
+
+// Run processes task with the run function set by WithFn.
+func (w *ChannelWorker) Run(ctx context.Context, task core.TaskMessage) error {
+	if w.runFunc == nil {
+		return ErrMissingRunFunc
+	}
+	return w.runFunc(ctx, task)
+}
+
+// Shutdown stops handing out tasks. It returns ErrQueueShutdown if the
+// worker is already shut down.
+func (w *ChannelWorker) Shutdown() error {
+	if !atomic.CompareAndSwapInt32(&w.stopFlag, 0, 1) {
+		return ErrQueueShutdown
+	}
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	return nil
+}
+
+// Queue returns ErrReadOnlyWorker, the tasks come from the channel only.
+func (w *ChannelWorker) Queue(task core.TaskMessage) error {
+	return ErrReadOnlyWorker
+}
+
+// Local reports true, the tasks are handled by this process.
+func (w *ChannelWorker) Local() bool {
+	return true
+}
+
+// Usage returns the number of messages buffered in the channel.
+func (w *ChannelWorker) Usage() int {
+	return len(w.source)
+}
+
+// Capacity returns the buffer size of the channel.
+func (w *ChannelWorker) Capacity() int {
+	return cap(w.source)
+}
+
+// Request retrieves the next message from the channel without waiting.
+// It returns ErrNoTaskInQueue when the channel is empty, and
+// ErrQueueHasBeenClosed once the channel is closed or the worker is shut
+// down.
+func (w *ChannelWorker) Request() (core.TaskMessage, error) {
+	if atomic.LoadInt32(&w.stopFlag) == 1 {
+		return nil, ErrQueueHasBeenClosed
+	}
+
+	select {
+	case m, ok := <-w.source:
+		return w.task(m, ok)
+	default:
+		return nil, ErrNoTaskInQueue
+	}
+}
+
+// RequestWithContext retrieves the next message like Request, but waits
+// for one to be sent on the channel. It returns ctx.Err() when ctx is done
+// first.
+func (w *ChannelWorker) RequestWithContext(ctx context.Context) (core.TaskMessage, error) {
+	if atomic.LoadInt32(&w.stopFlag) == 1 {
+		return nil, ErrQueueHasBeenClosed
+	}
+
+	select {
+	case m, ok := <-w.source:
+		return w.task(m, ok)
+	case <-w.stop:
+		return nil, ErrQueueHasBeenClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// task turns a message received from the channel into a task, ok is false
+// when the channel is closed.
+func (w *ChannelWorker) task(m core.QueuedMessage, ok bool) (core.TaskMessage, error) {
+	if !ok {
+		return nil, ErrQueueHasBeenClosed
+	}
+	if m == nil {
+		return nil, ErrNilMessage
+	}
+	if t, ok := m.(*job.Message); ok {
+		return t, nil
+	}
+	data := job.NewMessage(m)
+	return &data, nil
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bytesMessage is a message only exposing its encoded form.
+type bytesMessage []byte
+
+func (m bytesMessage) Bytes() []byte {
+	return m
+}
+
+func TestChannelWorker(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []string
+	ch := make(chan core.QueuedMessage, 2)
+	w := NewChannelWorker(ch, WithFn(func(ctx context.Context, m core.TaskMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		payloads = append(payloads, string(m.Payload()))
+		return nil
+	}))
+	assert.Equal(t, 2, w.Capacity())
+
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	m := job.NewMessage(mockMessage{message: "c"})
+	for _, msg := range []core.QueuedMessage{bytesMessage("a"), mockMessage{message: "b"}, &m} {
+		ch <- msg
+	}
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 3
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	assert.Equal(t, []string{"a", "b", "c"}, payloads)
+	assert.Equal(t, 0, w.Usage())
+}
+
+func TestChannelWorkerReadOnly(t *testing.T) {
+	w := NewChannelWorker(make(chan core.QueuedMessage))
+	assert.Equal(t, ErrReadOnlyWorker, w.Queue(mockMessage{message: "foo"}))
+
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, q.Queue(mockMessage{message: "foo"}), ErrReadOnlyWorker)
+	q.Release()
+}
+
+func TestChannelWorkerRequest(t *testing.T) {
+	ch := make(chan core.QueuedMessage, 1)
+	w := NewChannelWorker(ch)
+
+	_, err := w.Request()
+	assert.Equal(t, ErrNoTaskInQueue, err)
+
+	ch <- bytesMessage("foo")
+	task, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(task.Payload()))
+	assert.Equal(t, ErrMissingRunFunc, w.Run(context.Background(), task))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = w.RequestWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the caller closing the channel closes the worker
+	close(ch)
+	_, err = w.Request()
+	assert.Equal(t, ErrQueueHasBeenClosed, err)
+
+	assert.NoError(t, w.Shutdown())
+	assert.Equal(t, ErrQueueShutdown, w.Shutdown())
+	_, err = w.RequestWithContext(context.Background())
+	assert.Equal(t, ErrQueueHasBeenClosed, err)
+}
+
+func TestChannelWorkerShutdown(t *testing.T) {
+	w := NewChannelWorker(make(chan core.QueuedMessage))
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.RequestWithContext(context.Background())
+		done <- err
+	}()
+
+	// a waiting request returns on shutdown
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, w.Shutdown())
+	assert.Equal(t, ErrQueueHasBeenClosed, <-done)
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of the queue, replaceable to drive timeouts and
+// delays deterministically in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After waits for the duration to elapse and then sends the current
+	// time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+	// Sleep pauses the current goroutine for at least the duration d.
+	Sleep(d time.Duration)
+}
+
+var defaultClock Clock = realClock{}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+// withTimeout behaves like context.WithTimeout with the deadline measured
+// by clock.
+func withTimeout(parent context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(realClock); ok {
+		return context.WithTimeout(parent, d)
+	}
+
+	c := &clockContext{
+		Context:  parent,
+		deadline: clock.Now().Add(d),
+		done:     make(chan struct{}),
+	}
+	if err := parent.Err(); err != nil {
+		c.cancel(err)
+		return c, func() {}
+	}
+
+	stop := context.AfterFunc(parent, func() {
+		c.cancel(parent.Err())
+	})
+	timer := clock.After(d)
+	go func() {
+		select {
+		case <-timer:
+			c.cancel(context.DeadlineExceeded)
+		case <-c.done:
+		}
+	}()
+
+	return c, func() {
+		stop()
+		c.cancel(context.Canceled)
+	}
+}
+
+// clockContext is a context whose deadline is driven by a Clock.
+type clockContext struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+	once     sync.Once
+	err      error
+}
+
+func (c *clockContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *clockContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *clockContext) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *clockContext) cancel(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance moves the clock forward and fires the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = timers
+}
+
+// Waiters returns the number of pending timers.
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func TestClockDrivesTimeout(t *testing.T) {
+	clock := newFakeClock()
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithClock(clock),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	m := &job.Message{
+		ID:      "slow",
+		Timeout: time.Hour,
+		Task: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- q.handle(context.Background(), m)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return clock.Waiters() == 1
+	}, time.Second, time.Millisecond)
+	clock.Advance(time.Hour)
+
+	err = <-done
+	var timeoutErr *job.TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, time.Hour, timeoutErr.Elapsed)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestClockDrivesRetryDelay(t *testing.T) {
+	clock := newFakeClock()
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithClock(clock),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	var attempts int32
+	m := &job.Message{
+		Timeout:    time.Hour,
+		RetryCount: 1,
+		RetryDelay: time.Minute,
+		Task: func(ctx context.Context) error {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				return errors.New("try again")
+			}
+			return nil
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- q.handle(context.Background(), m)
+	}()
+
+	// the job timeout and the retry delay
+	assert.Eventually(t, func() bool {
+		return clock.Waiters() == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	clock.Advance(time.Minute)
+	assert.NoError(t, <-done)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
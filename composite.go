@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+)
+
+// workerSet holds the workers behind a composite worker. It consumes from
+// them fairly and runs every message with the worker that handed it out.
+type workerSet struct {
+	workers []core.Worker
+	owners  sync.Map // *job.Message -> core.Worker
+	mu      sync.Mutex
+	next    int
+}
+
+// rotate returns the index to start from and advances it for the next call.
+func (s *workerSet) rotate() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.next
+	s.next = (s.next + 1) % len(s.workers)
+	return i
+}
+
+// has reports whether worker is one of the workers of the set.
+func (s *workerSet) has(worker core.Worker) bool {
+	for _, w := range s.workers {
+		if w == worker {
+			return true
+		}
+	}
+	return false
+}
+
+// queueTo adds task to worker only, which must be one of the set.
+func (s *workerSet) queueTo(worker core.Worker, task core.TaskMessage) error {
+	return worker.Queue(task)
+}
+
+// Run processes task with the worker that handed it out. Tasks of unknown
+// origin are run by the first worker.
+func (s *workerSet) Run(ctx context.Context, task core.TaskMessage) error {
+	if m, ok := task.(*job.Message); ok {
+		if owner, ok := s.owners.Load(m); ok {
+			return owner.(core.Worker).Run(ctx, task)
+		}
+	}
+	return s.workers[0].Run(ctx, task)
+}
+
+// Finish forgets the worker that handed task out and passes the outcome on
+// to it, if it implements core.Finisher. Tasks of unknown origin are passed
+// on to every such worker, which ignore the ones they don't know.
+func (s *workerSet) Finish(task core.TaskMessage, err error) {
+	if m, ok := task.(*job.Message); ok {
+		if owner, ok := s.owners.LoadAndDelete(m); ok {
+			if f, ok := owner.(core.Finisher); ok {
+				f.Finish(task, err)
+			}
+			return
+		}
+	}
+	for _, worker := range s.workers {
+		if f, ok := worker.(core.Finisher); ok {
+			f.Finish(task, err)
+		}
+	}
+}
+
+// OnDrop sets fn as the drop function of the workers implementing
+// core.DropNotifier.
+func (s *workerSet) OnDrop(fn func(core.TaskMessage)) {
+	for _, worker := range s.workers {
+		if d, ok := worker.(core.DropNotifier); ok {
+			d.OnDrop(fn)
+		}
+	}
+}
+
+// Local reports whether every worker is local.
+func (s *workerSet) Local() bool {
+	for _, worker := range s.workers {
+		if !isLocal(worker) {
+			return false
+		}
+	}
+	return true
+}
+
+// Shutdown shuts down every worker and returns their errors joined.
+func (s *workerSet) Shutdown() error {
+	errs := make([]error, 0, len(s.workers))
+	for _, worker := range s.workers {
+		errs = append(errs, worker.Shutdown())
+	}
+	return errors.Join(errs...)
+}
+
+// Request returns a task from the first worker that has one, starting from
+// a different worker on every call so that none of them is starved. A task
+// handed out with an error is returned along with it, as core.Worker
+// requires. It returns ErrQueueHasBeenClosed once every worker is closed.
+func (s *workerSet) Request() (core.TaskMessage, error) {
+	start := s.rotate()
+
+	closed := 0
+	var lastErr error
+	for i := range s.workers {
+		worker := s.workers[(start+i)%len(s.workers)]
+		task, err := worker.Request()
+		if task != nil {
+			// run and finish it with the worker it comes from
+			if m, ok := task.(*job.Message); ok {
+				s.owners.Store(m, worker)
+			}
+			return task, err
+		}
+		if errors.Is(err, ErrQueueHasBeenClosed) {
+			closed++
+			continue
+		}
+		lastErr = err
+	}
+
+	if closed == len(s.workers) {
+		return nil, ErrQueueHasBeenClosed
+	}
+	if lastErr == nil {
+		lastErr = ErrNoTaskInQueue
+	}
+	return nil, lastErr
+}
@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"io"
+	"time"
 )
 
 // Worker represents an interface for a worker that processes tasks.
@@ -21,9 +23,134 @@ type Worker interface {
 
 	// Request retrieves a task from the worker's queue.
 	// It returns the queued message and an error if the retrieval fails.
+	// The queue handles the combinations as follows:
+	//   - a task and a nil error: the task is run.
+	//   - a task and an error: the task is run and the error is logged,
+	//     a task handed out is never dropped.
+	//   - no task and queue.ErrNoTaskInQueue, or no error: the queue is
+	//     empty, it is polled again after the poll interval. Once the queue
+	//     is shut down only queue.ErrNoTaskInQueue keeps it polling, until
+	//     the worker reports it is closed.
+	//   - no task and any other error: the request failed, it is retried
+	//     after the poll interval until the queue is shut down.
 	Request() (TaskMessage, error)
 }
 
+// BatchRequester is implemented by workers that can hand out several tasks
+// in a single round-trip to their backend.
+type BatchRequester interface {
+	// RequestBatch retrieves up to n tasks from the worker's queue.
+	// It reports an empty queue the same way Request does.
+	RequestBatch(n int) ([]TaskMessage, error)
+}
+
+// ContextRequester is implemented by workers whose Request can block until
+// a task is available. The context is cancelled when the queue shuts down.
+type ContextRequester interface {
+	// RequestWithContext retrieves a task from the worker's queue, waiting
+	// for one to arrive until ctx is done.
+	RequestWithContext(ctx context.Context) (TaskMessage, error)
+}
+
+// LocalWorker is implemented by workers that can tell whether queued tasks
+// stay in the current process. Task functions can't be encoded, so the queue
+// refuses them for workers reporting false. Workers not implementing it are
+// assumed to be local.
+type LocalWorker interface {
+	// Local reports whether queued tasks are handled by this process.
+	Local() bool
+}
+
+// UsageReporter is implemented by workers that can tell how many tasks they
+// hold. Workers for which the length isn't cheap to compute may return -1
+// to report it as unknown.
+type UsageReporter interface {
+	// Usage returns the number of buffered tasks, or -1 if it is unknown.
+	Usage() int
+}
+
+// CapacityReporter is implemented by workers with a bounded buffer.
+type CapacityReporter interface {
+	// Capacity returns the maximum number of buffered tasks, or zero if
+	// there is no limit.
+	Capacity() int
+}
+
+// LeaseExtender is implemented by workers whose backend only hands a task
+// out for a limited time, e.g. a visibility timeout, and redelivers it
+// unless the lease is extended while the task runs.
+type LeaseExtender interface {
+	// ExtendLease renews the lease of a task being handled.
+	ExtendLease(ctx context.Context, task TaskMessage) error
+}
+
+// DelayedRequeuer is implemented by workers whose backend can deliver a
+// message again after a delay, e.g. with a visibility timeout. The queue
+// hands the retries of failed jobs to it instead of waiting for the retry
+// delay in process, which frees the worker at once.
+type DelayedRequeuer interface {
+	// RequeueAfter publishes task again, to be delivered after delay. The
+	// queue falls back to waiting in process when it returns an error, and
+	// finishes the task handed out otherwise, see Finisher.
+	RequeueAfter(task TaskMessage, delay time.Duration) error
+}
+
+// TTLQueuer is implemented by workers whose backend can expire a message
+// natively, e.g. with a per-message TTL. The queue hands it the messages
+// given a max age, so that the backend drops them once they expire instead
+// of delivering them. The queue still skips the expired messages it gets.
+type TTLQueuer interface {
+	// QueueWithTTL adds task to the worker's queue, to be discarded once
+	// ttl has elapsed.
+	QueueWithTTL(task TaskMessage, ttl time.Duration) error
+}
+
+// BatchAcker is implemented by workers that acknowledge handled tasks to
+// their backend in groups, e.g. by committing an offset or deleting a batch
+// of messages, instead of one by one. On shutdown the last tasks are
+// acknowledged once the running jobs finished, which may be after Shutdown
+// of the worker returned.
+type BatchAcker interface {
+	// AckBatch acknowledges the tasks, which were all handled successfully.
+	AckBatch(tasks []TaskMessage) error
+}
+
+// Finisher is implemented by workers that keep track of the tasks they
+// handed out, e.g. to delete them from their backend once handled. The queue
+// calls Finish once for every task Request returned, when it is done with it.
+type Finisher interface {
+	// Finish reports the outcome of task. err is nil when the task is
+	// settled for good: it succeeded, expired, was dropped or dead-lettered,
+	// or was queued again as a new task. Otherwise it is the error the task
+	// failed with and the worker may deliver it again. Tasks the worker
+	// doesn't know must be ignored.
+	Finish(task TaskMessage, err error)
+}
+
+// DropNotifier is implemented by workers that may discard tasks they
+// accepted, e.g. to make room for newer ones once they are full. The queue
+// registers the function failing the jobs dropped this way.
+type DropNotifier interface {
+	// OnDrop sets the function called with every task discarded after
+	// Queue accepted it.
+	OnDrop(fn func(TaskMessage))
+}
+
+// BeforeRunner is implemented by workers that need to prepare, e.g. connect
+// to a broker, before the queue starts requesting tasks.
+type BeforeRunner interface {
+	// BeforeRun is called once by Queue.Start. A non-nil error aborts the start.
+	BeforeRun() error
+}
+
+// AfterRunner is implemented by workers that need to clean up once the queue
+// has been shut down.
+type AfterRunner interface {
+	// AfterRun is called once by Queue.Shutdown after the worker is shut
+	// down, if Queue.Start succeeded, i.e. BeforeRun returned no error.
+	AfterRun() error
+}
+
 // QueuedMessage represents an interface for a message that can be queued.
 // It requires the implementation of a Bytes method, which returns the message
 // content as a slice of bytes.
@@ -31,6 +158,14 @@ type QueuedMessage interface {
 	Bytes() []byte
 }
 
+// StreamedMessage is implemented by messages whose payload is read as a
+// stream instead of held in memory. The queue passes the reader through to
+// local workers and falls back to Bytes for the others.
+type StreamedMessage interface {
+	QueuedMessage
+	Reader() io.Reader
+}
+
 // TaskMessage represents an interface for a task message that can be queued.
 // It embeds the QueuedMessage interface and adds a method to retrieve the payload of the message.
 type TaskMessage interface {
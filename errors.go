@@ -1,6 +1,9 @@
 package queue
 
-import "errors"
+import (
+	"errors"
+	"net"
+)
 
 var (
 	// ErrNoTaskInQueue there is nothing in the queue
@@ -9,4 +12,99 @@ var (
 	ErrQueueHasBeenClosed = errors.New("golang-queue: queue has been closed")
 	// ErrMaxCapacity Maximum size limit reached
 	ErrMaxCapacity = errors.New("golang-queue: maximum size limit reached")
+	// ErrMaxBytes Maximum byte budget reached
+	ErrMaxBytes = errors.New("golang-queue: maximum byte budget reached")
+	// ErrTaskDropped the worker discarded the task, see OverflowDropOldest
+	// and OverflowDropNewest
+	ErrTaskDropped = errors.New("golang-queue: task dropped")
+	// ErrTaskNotSerializable task functions can't be sent to a remote worker
+	ErrTaskNotSerializable = errors.New("golang-queue: task function can't be sent to a remote worker")
+	// ErrCancelledOnShutdown wraps the error of a job cancelled because the
+	// queue was shut down while it was running
+	ErrCancelledOnShutdown = errors.New("golang-queue: job cancelled on shutdown")
+	// errRetryDelegated the retry of a job was handed to a core.DelayedRequeuer
+	errRetryDelegated = errors.New("golang-queue: retry delegated to the worker")
+	// ErrInvalidOption an option given to NewQueue can't be used
+	ErrInvalidOption = errors.New("golang-queue: invalid option")
+	// ErrUnknownWorker the worker given to QueueTo is not one of the queue
+	ErrUnknownWorker = errors.New("golang-queue: unknown worker")
+	// ErrPayloadTooLarge the payload exceeds the size set by WithMaxPayloadSize
+	ErrPayloadTooLarge = errors.New("golang-queue: payload too large")
+	// ErrInvalidTimeout the function set by WithDynamicTimeout returned a
+	// timeout that isn't positive
+	ErrInvalidTimeout = errors.New("golang-queue: invalid dynamic timeout")
+	// ErrJobExpired the job waited in the queue longer than its max age
+	ErrJobExpired = errors.New("golang-queue: job expired")
+	// ErrReadOnlyWorker the worker only hands out tasks, e.g. a ChannelWorker
+	ErrReadOnlyWorker = errors.New("golang-queue: worker is read-only")
+	// ErrMissingID the job has no ID, set with job.AllowOption.ID
+	ErrMissingID = errors.New("golang-queue: job ID is required")
+	// ErrNilMessage a nil message was submitted
+	ErrNilMessage = errors.New("golang-queue: message is nil")
+	// ErrNilTask a nil task function was submitted
+	ErrNilTask = errors.New("golang-queue: task function is nil")
+	// ErrMissingRunFunc a message without task function reached a worker
+	// without run function
+	ErrMissingRunFunc = errors.New("golang-queue: no task function and no run function set")
+	// ErrCircuitOpen the circuit breaker refused to run the job
+	ErrCircuitOpen = errors.New("golang-queue: circuit breaker is open")
+	// ErrDecodeMessage a message handed out by the worker can't be decoded
+	ErrDecodeMessage = errors.New("golang-queue: message can't be decoded")
 )
+
+var (
+	// ErrCategoryCapacity the worker has no room left for the task
+	ErrCategoryCapacity = errors.New("golang-queue: capacity")
+	// ErrCategoryConnection the worker can't reach its backend
+	ErrCategoryConnection = errors.New("golang-queue: connection")
+	// ErrCategoryShutdown the worker has been shut down
+	ErrCategoryShutdown = errors.New("golang-queue: shutdown")
+	// ErrCategoryUnknown the worker failed for another reason
+	ErrCategoryUnknown = errors.New("golang-queue: unknown")
+)
+
+// QueueError is returned when the worker refuses a task. Category is one of
+// the ErrCategory errors and matches with errors.Is, like the cause, which
+// errors.Unwrap returns.
+type QueueError struct {
+	Category error
+	Err      error
+}
+
+func (e *QueueError) Error() string {
+	return e.Category.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the worker.
+func (e *QueueError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the category of the error.
+func (e *QueueError) Is(target error) bool {
+	return target == e.Category
+}
+
+// newQueueError wraps the error returned by a worker refusing a task into a
+// QueueError. Workers can set the category themselves by wrapping one of the
+// ErrCategory errors, otherwise it is guessed from the error.
+func newQueueError(err error) *QueueError {
+	category := ErrCategoryUnknown
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrCategoryCapacity),
+		errors.Is(err, ErrMaxCapacity),
+		errors.Is(err, ErrMaxBytes),
+		errors.Is(err, ErrTaskDropped):
+		category = ErrCategoryCapacity
+	case errors.Is(err, ErrCategoryShutdown),
+		errors.Is(err, ErrQueueShutdown),
+		errors.Is(err, ErrQueueHasBeenClosed):
+		category = ErrCategoryShutdown
+	case errors.Is(err, ErrCategoryConnection),
+		errors.As(err, &netErr):
+		category = ErrCategoryConnection
+	}
+
+	return &QueueError{Category: category, Err: err}
+}
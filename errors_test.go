@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/golang-queue/queue/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestQueueErrorCapacity(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing(WithQueueSize(1))),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	err = q.Queue(mockMessage{message: "bar"})
+
+	var queueErr *QueueError
+	assert.True(t, errors.As(err, &queueErr))
+	assert.Equal(t, ErrCategoryCapacity, queueErr.Category)
+	assert.ErrorIs(t, err, ErrCategoryCapacity)
+	assert.ErrorIs(t, err, ErrMaxCapacity)
+	assert.Equal(t, ErrMaxCapacity, errors.Unwrap(err))
+	assert.NotErrorIs(t, err, ErrCategoryConnection)
+}
+
+func TestQueueErrorConnection(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	connErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	w := mocks.NewMockWorker(controller)
+	w.EXPECT().Queue(gomock.Any()).Return(connErr)
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	err = q.QueueTask(func(ctx context.Context) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrCategoryConnection)
+	assert.Equal(t, connErr, errors.Unwrap(err))
+}
+
+func TestNewQueueError(t *testing.T) {
+	custom := errors.New("broker is read-only")
+	tests := []struct {
+		err      error
+		category error
+	}{
+		{ErrMaxBytes, ErrCategoryCapacity},
+		{ErrQueueShutdown, ErrCategoryShutdown},
+		{ErrQueueHasBeenClosed, ErrCategoryShutdown},
+		{&net.DNSError{Err: "no such host", Name: "broker"}, ErrCategoryConnection},
+		{custom, ErrCategoryUnknown},
+		// workers can tag their own errors
+		{errors.Join(ErrCategoryConnection, custom), ErrCategoryConnection},
+	}
+
+	for _, tt := range tests {
+		err := newQueueError(tt.err)
+		assert.Equal(t, tt.category, err.Category, tt.err.Error())
+		assert.ErrorIs(t, err, tt.err)
+	}
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+var defaultEventBuffer = 64
+
+// Event describes how a task finished.
+type Event struct {
+	ID       string        // ID is the job ID, empty for jobs submitted without one.
+	Outcome  JobStatus     // Outcome is either JobSucceeded or JobFailed.
+	Duration time.Duration // Duration is the time spent handling the task, retries included.
+	Attempt  int           // Attempt is the number of the final attempt, starting at 1.
+}
+
+type attemptKey struct{}
+
+// withAttemptCounter returns a copy of ctx carrying counter, which handle
+// sets to the number of each attempt.
+func withAttemptCounter(ctx context.Context, counter *int32) context.Context {
+	return context.WithValue(ctx, attemptKey{}, counter)
+}
+
+// countAttempt stores the number of the current attempt in the counter
+// carried by ctx, if any.
+func countAttempt(ctx context.Context, number int) {
+	if counter, ok := ctx.Value(attemptKey{}).(*int32); ok {
+		atomic.StoreInt32(counter, int32(number))
+	}
+}
+
+// Events returns the stream of task outcomes. Sending never blocks a worker:
+// events that do not fit in the buffer set by WithEventBuffer are dropped.
+func (q *Queue) Events() <-chan Event {
+	return q.events
+}
+
+// emit publishes e unless the event buffer is full.
+func (q *Queue) emit(e Event) {
+	select {
+	case q.events <- e:
+	default:
+	}
+}
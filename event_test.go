@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}, job.AllowOption{ID: job.String("ok")}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return errors.New("boom")
+	}, job.AllowOption{
+		ID:         job.String("fail"),
+		RetryCount: job.Int64(2),
+		RetryDelay: job.Time(time.Millisecond),
+	}))
+	assert.NoError(t, q.Start())
+
+	e := <-q.Events()
+	assert.Equal(t, "ok", e.ID)
+	assert.Equal(t, JobSucceeded, e.Outcome)
+	assert.Equal(t, 1, e.Attempt)
+	assert.GreaterOrEqual(t, e.Duration, 10*time.Millisecond)
+
+	e = <-q.Events()
+	assert.Equal(t, "fail", e.ID)
+	assert.Equal(t, JobFailed, e.Outcome)
+	assert.Equal(t, 3, e.Attempt)
+
+	q.Release()
+}
+
+func TestEventsWithoutSubscriber(t *testing.T) {
+	total := 20
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithEventBuffer(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+
+	// nobody reads the events, processing must not stall
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == uint64(total)
+	}, time.Second, 5*time.Millisecond)
+	q.Release()
+
+	assert.Len(t, q.Events(), 1)
+}
@@ -0,0 +1,70 @@
+package job
+
+import "context"
+
+type contextKey int
+
+const (
+	workerIDKey contextKey = iota
+	headersKey
+	attemptKey
+)
+
+// attempt is the retry loop state carried by the context of a task.
+type attempt struct {
+	number, max int
+}
+
+// ContextWithWorkerID returns a copy of ctx carrying the index of the worker
+// slot that runs the task.
+func ContextWithWorkerID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, workerIDKey, id)
+}
+
+// WorkerID returns the index of the worker slot running the task, in the
+// range [0, workerCount). It returns -1 if ctx carries no worker index.
+func WorkerID(ctx context.Context) int {
+	if id, ok := ctx.Value(workerIDKey).(int); ok {
+		return id
+	}
+	return -1
+}
+
+// ContextWithHeaders returns a copy of ctx carrying the headers of the
+// message being handled.
+func ContextWithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, headersKey, headers)
+}
+
+// HeadersFromContext returns the headers of the message being handled, or
+// nil if ctx carries none. The map must not be modified.
+func HeadersFromContext(ctx context.Context) map[string]string {
+	h, _ := ctx.Value(headersKey).(map[string]string)
+	return h
+}
+
+// Header returns the value of a single header of the message being handled.
+func Header(ctx context.Context, key string) string {
+	return HeadersFromContext(ctx)[key]
+}
+
+// ContextWithAttempt returns a copy of ctx carrying the number of the
+// current attempt, starting at 1, and the number of attempts the job gets.
+func ContextWithAttempt(ctx context.Context, number, max int) context.Context {
+	return context.WithValue(ctx, attemptKey, attempt{number: number, max: max})
+}
+
+// Attempt returns the number of the current attempt of the task, starting
+// at 1. It returns 0 if ctx carries no attempt.
+func Attempt(ctx context.Context) int {
+	a, _ := ctx.Value(attemptKey).(attempt)
+	return a.number
+}
+
+// MaxAttempts returns the number of attempts the task gets, its retry count
+// plus one, so that Attempt(ctx) == MaxAttempts(ctx) on the last one. It
+// returns 0 if ctx carries no attempt.
+func MaxAttempts(ctx context.Context) int {
+	a, _ := ctx.Value(attemptKey).(attempt)
+	return a.max
+}
@@ -0,0 +1,33 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerID(t *testing.T) {
+	assert.Equal(t, -1, WorkerID(context.Background()))
+
+	ctx := ContextWithWorkerID(context.Background(), 3)
+	assert.Equal(t, 3, WorkerID(ctx))
+}
+
+func TestHeadersFromContext(t *testing.T) {
+	assert.Nil(t, HeadersFromContext(context.Background()))
+	assert.Equal(t, "", Header(context.Background(), "source"))
+
+	ctx := ContextWithHeaders(context.Background(), map[string]string{"source": "api"})
+	assert.Equal(t, map[string]string{"source": "api"}, HeadersFromContext(ctx))
+	assert.Equal(t, "api", Header(ctx, "source"))
+}
+
+func TestAttempt(t *testing.T) {
+	assert.Equal(t, 0, Attempt(context.Background()))
+	assert.Equal(t, 0, MaxAttempts(context.Background()))
+
+	ctx := ContextWithAttempt(context.Background(), 2, 3)
+	assert.Equal(t, 2, Attempt(ctx))
+	assert.Equal(t, 3, MaxAttempts(ctx))
+}
@@ -0,0 +1,35 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTaskTimeout the job ran out of time
+var ErrTaskTimeout = errors.New("golang-queue: task timeout")
+
+// ErrUnsupportedVersion the message was encoded by a later version
+var ErrUnsupportedVersion = errors.New("golang-queue: unsupported message version")
+
+// TimeoutError is returned when a job doesn't finish before its deadline.
+// It matches both ErrTaskTimeout and context.DeadlineExceeded with errors.Is.
+type TimeoutError struct {
+	// ID is the job ID, empty for jobs submitted without one.
+	ID string
+	// Elapsed is the time spent on the job before it was given up.
+	Elapsed time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("%s after %s", ErrTaskTimeout, e.Elapsed)
+	}
+	return fmt.Sprintf("%s: job %s after %s", ErrTaskTimeout, e.ID, e.Elapsed)
+}
+
+// Unwrap returns ErrTaskTimeout and context.DeadlineExceeded.
+func (e *TimeoutError) Unwrap() []error {
+	return []error{ErrTaskTimeout, context.DeadlineExceeded}
+}
@@ -0,0 +1,30 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutError(t *testing.T) {
+	var err error = &TimeoutError{ID: "foo", Elapsed: time.Second}
+
+	assert.True(t, errors.Is(err, ErrTaskTimeout))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.False(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "golang-queue: task timeout: job foo after 1s", err.Error())
+
+	// still matched once wrapped again
+	wrapped := fmt.Errorf("send mail: %w", err)
+	var timeoutErr *TimeoutError
+	assert.True(t, errors.As(wrapped, &timeoutErr))
+	assert.Equal(t, "foo", timeoutErr.ID)
+	assert.True(t, errors.Is(wrapped, context.DeadlineExceeded))
+
+	err = &TimeoutError{Elapsed: time.Second}
+	assert.Equal(t, "golang-queue: task timeout after 1s", err.Error())
+}
@@ -1,8 +1,10 @@
 package job
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"time"
 
 	"github.com/golang-queue/queue/core"
@@ -11,15 +13,41 @@ import (
 // TaskFunc is the task function
 type TaskFunc func(context.Context) error
 
+// ResultFunc is the task function returning a result value
+type ResultFunc func(context.Context) (interface{}, error)
+
 // Message describes a task and its metadata.
 type Message struct {
 	Task TaskFunc `json:"-" msgpack:"-"`
 
+	// Stream is the payload of a core.StreamedMessage, read by the handler
+	// instead of Body. It can't be encoded and is only read once, so a
+	// retried job finds it consumed.
+	// nil if not specified
+	Stream io.Reader `json:"-" msgpack:"-"`
+
+	// ID identifies the job for status tracking.
+	// empty if not specified
+	ID string `json:"id,omitempty" msgpack:"id,omitempty"`
+
 	// Timeout is the duration the task can be processed by Handler.
 	// zero if not specified
 	// default is 60 time.Minute
 	Timeout time.Duration `json:"timeout" msgpack:"timeout"`
 
+	// TotalTimeout bounds the cumulative time of all attempts including
+	// retry delays. When set, Timeout applies to each attempt instead.
+	// zero if not specified
+	TotalTimeout time.Duration `json:"total_timeout,omitempty" msgpack:"total_timeout,omitempty"`
+
+	// SoftTimeout is the time after which the job is reported as slow
+	// while it keeps running, zero disables it.
+	SoftTimeout time.Duration `json:"soft_timeout,omitempty" msgpack:"soft_timeout,omitempty"`
+
+	// MaxAge is how long the message may wait in the queue, measured from
+	// EnqueuedAt, before it is skipped instead of run. zero means no limit
+	MaxAge time.Duration `json:"max_age,omitempty" msgpack:"max_age,omitempty"`
+
 	// Payload is the payload data of the task.
 	Body []byte `json:"body" msgpack:"body"`
 
@@ -48,6 +76,50 @@ type Message struct {
 
 	// Jitter eases contention by randomizing backoff steps
 	Jitter bool `json:"jitter" msgpack:"jitter"`
+
+	// ConcurrencyKey limits jobs sharing the same key to one in flight.
+	// empty means no limit
+	ConcurrencyKey string `json:"concurrency_key,omitempty" msgpack:"concurrency_key,omitempty"`
+
+	// PartitionKey makes the jobs sharing it run one at a time in the order
+	// they were requested from the worker.
+	// empty if not specified
+	PartitionKey string `json:"partition_key,omitempty" msgpack:"partition_key,omitempty"`
+
+	// Topic groups jobs that can be paused together.
+	// empty if not specified
+	Topic string `json:"topic,omitempty" msgpack:"topic,omitempty"`
+
+	// Class groups jobs sharing a concurrency limit, e.g. slow ones.
+	Class string `json:"class,omitempty" msgpack:"class,omitempty"`
+
+	// Headers carries metadata, e.g. the content type or the source, along
+	// with the payload. The handler reads them with HeadersFromContext.
+	Headers map[string]string `json:"headers,omitempty" msgpack:"headers,omitempty"`
+
+	// EnqueuedAt is the time the message was submitted to the queue, used
+	// to measure how long it waited before a worker started it.
+	// zero if not submitted yet
+	EnqueuedAt time.Time `json:"enqueued_at" msgpack:"enqueued_at"`
+
+	// Attempt is the number of attempts made before the job was handed
+	// back to the queue or the backend for a retry, so that the attempt
+	// numbers carry on across deliveries.
+	// zero for the first delivery
+	Attempt int `json:"attempt,omitempty" msgpack:"attempt,omitempty"`
+
+	// MaxAttempts is the number of attempts the job got on its first
+	// delivery, set along with Attempt.
+	// zero for the first delivery
+	MaxAttempts int `json:"max_attempts,omitempty" msgpack:"max_attempts,omitempty"`
+
+	// Requeues counts how often the job was pushed back onto the queue
+	// after failing.
+	Requeues int `json:"requeues,omitempty" msgpack:"requeues,omitempty"`
+
+	// Version is the encoding version of the message, see Version.
+	// zero for messages encoded before it was introduced
+	Version int `json:"version,omitempty" msgpack:"version,omitempty"`
 }
 
 // Payload returns the payload data of the Message.
@@ -59,6 +131,15 @@ func (m *Message) Payload() []byte {
 	return m.Body
 }
 
+// Reader returns the payload as a stream, Stream when it is set and Body
+// otherwise.
+func (m *Message) Reader() io.Reader {
+	if m.Stream != nil {
+		return m.Stream
+	}
+	return bytes.NewReader(m.Body)
+}
+
 // Bytes returns the byte slice of the Message struct.
 // If the marshalling process encounters an error, the function will panic.
 // It returns the marshalled byte slice.
@@ -74,18 +155,39 @@ func (m *Message) Bytes() []byte {
 	return b
 }
 
-// NewMessage create new message
+// NewMessage create new message. A core.StreamedMessage is not read, its
+// reader becomes the Stream of the message.
 func NewMessage(m core.QueuedMessage, opts ...AllowOption) Message {
 	o := NewOptions(opts...)
 
+	var body []byte
+	var stream io.Reader
+	if s, ok := m.(core.StreamedMessage); ok {
+		stream = s.Reader()
+	} else {
+		body = m.Bytes()
+	}
+
 	return Message{
+		Stream:      stream,
 		RetryCount:  o.retryCount,
 		RetryDelay:  o.retryDelay,
 		RetryFactor: o.retryFactor,
 		RetryMin:    o.retryMin,
 		RetryMax:    o.retryMax,
 		Timeout:     o.timeout,
-		Body:        m.Bytes(),
+		Body:        body,
+
+		ID:             o.id,
+		TotalTimeout:   o.totalTimeout,
+		SoftTimeout:    o.softTimeout,
+		MaxAge:         o.maxAge,
+		ConcurrencyKey: o.concurrencyKey,
+		PartitionKey:   o.partitionKey,
+		Topic:          o.topic,
+		Class:          o.class,
+		Headers:        o.headers,
+		Version:        Version,
 	}
 }
 
@@ -100,6 +202,17 @@ func NewTask(task TaskFunc, opts ...AllowOption) Message {
 		RetryMin:    o.retryMin,
 		RetryMax:    o.retryMax,
 		Task:        task,
+
+		ID:             o.id,
+		TotalTimeout:   o.totalTimeout,
+		SoftTimeout:    o.softTimeout,
+		MaxAge:         o.maxAge,
+		ConcurrencyKey: o.concurrencyKey,
+		PartitionKey:   o.partitionKey,
+		Topic:          o.topic,
+		Class:          o.class,
+		Headers:        o.headers,
+		Version:        Version,
 	}
 }
 
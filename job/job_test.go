@@ -1,6 +1,8 @@
 package job
 
 import (
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -40,3 +42,77 @@ func TestMessageEncodeDecode(t *testing.T) {
 	assert.Equal(t, 20*time.Second, out.RetryMax)
 	assert.Equal(t, 4.0, out.RetryFactor)
 }
+
+func TestConcurrencyKeyEncodeDecode(t *testing.T) {
+	m := NewMessage(&mockMessage{
+		message: "foo",
+	}, AllowOption{
+		ConcurrencyKey: String("user-1"),
+	})
+
+	out := Decode(m.Bytes())
+	assert.Equal(t, "user-1", out.ConcurrencyKey)
+}
+
+func TestMessageID(t *testing.T) {
+	m := NewMessage(&mockMessage{
+		message: "foo",
+	}, AllowOption{
+		ID: String("job-1"),
+	})
+
+	out := Decode(m.Bytes())
+	assert.Equal(t, "job-1", out.ID)
+}
+
+func TestHeadersEncodeDecode(t *testing.T) {
+	m := NewMessage(&mockMessage{
+		message: "foo",
+	}, MergeOptions(
+		WithHeader("content-type", "application/json"),
+		WithHeader("source", "billing"),
+	))
+
+	out := Decode(m.Bytes())
+	assert.Equal(t, map[string]string{
+		"content-type": "application/json",
+		"source":       "billing",
+	}, out.Headers)
+
+	// no headers, no field
+	m = NewMessage(&mockMessage{message: "foo"})
+	assert.NotContains(t, string(m.Bytes()), "headers")
+}
+
+func TestEnqueuedAtEncodeDecode(t *testing.T) {
+	m := NewMessage(&mockMessage{
+		message: "foo",
+	})
+	m.EnqueuedAt = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	out := Decode(m.Bytes())
+	assert.True(t, m.EnqueuedAt.Equal(out.EnqueuedAt))
+}
+
+func TestMaxAgeEncodeDecode(t *testing.T) {
+	m := NewMessage(&mockMessage{
+		message: "foo",
+	}, WithMaxAge(time.Minute))
+	m.EnqueuedAt = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	out := Decode(m.Bytes())
+	assert.Equal(t, time.Minute, out.MaxAge)
+	assert.True(t, m.EnqueuedAt.Equal(out.EnqueuedAt))
+}
+
+func TestMessageReader(t *testing.T) {
+	m := NewMessage(&mockMessage{message: "foo"})
+	b, err := io.ReadAll(m.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+
+	m = Message{Stream: strings.NewReader("bar")}
+	b, err = io.ReadAll(m.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+}
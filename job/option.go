@@ -11,7 +11,16 @@ type Options struct {
 	retryMax    time.Duration
 	jitter      bool
 
-	timeout time.Duration
+	id             string
+	timeout        time.Duration
+	totalTimeout   time.Duration
+	softTimeout    time.Duration
+	maxAge         time.Duration
+	concurrencyKey string
+	partitionKey   string
+	topic          string
+	class          string
+	headers        map[string]string
 }
 
 // newDefaultOptions create new default options
@@ -29,6 +38,9 @@ func newDefaultOptions() Options {
 
 // AllowOption is a function that sets some option on the Options
 type AllowOption struct {
+	// ID identifies the job, e.g. to look up its status.
+	ID *string
+
 	RetryCount  *int64
 	RetryDelay  *time.Duration
 	RetryFactor *float64
@@ -36,6 +48,36 @@ type AllowOption struct {
 	RetryMax    *time.Duration
 	Jitter      *bool
 	Timeout     *time.Duration
+
+	// TotalTimeout bounds all attempts of a job including retry delays,
+	// turning Timeout into a per-attempt limit.
+	TotalTimeout *time.Duration
+
+	// SoftTimeout reports the job as slow once it elapses, without
+	// cancelling it, see WithSoftTimeout.
+	SoftTimeout *time.Duration
+
+	// MaxAge skips the job once it waited longer in the queue, see
+	// WithMaxAge.
+	MaxAge *time.Duration
+
+	// ConcurrencyKey serializes jobs sharing the same key: at most one of
+	// them runs at any time, while jobs with different keys run in parallel.
+	ConcurrencyKey *string
+
+	// PartitionKey orders jobs: those sharing the key run one at a time, in
+	// the order they were queued, while jobs of other keys run in parallel.
+	PartitionKey *string
+
+	// Topic tags the job so that it can be paused with Queue.PauseTopic.
+	Topic *string
+
+	// Class groups jobs whose concurrency is limited together, see
+	// queue.WithClassConcurrency.
+	Class *string
+
+	// Headers are copied to the message, see WithHeader.
+	Headers map[string]string
 }
 
 // NewOptions create new options
@@ -70,11 +112,157 @@ func NewOptions(opts ...AllowOption) Options {
 		if opts[0].Jitter != nil && *opts[0].Jitter != o.jitter {
 			o.jitter = *opts[0].Jitter
 		}
+
+		if opts[0].ID != nil {
+			o.id = *opts[0].ID
+		}
+
+		if opts[0].TotalTimeout != nil {
+			o.totalTimeout = *opts[0].TotalTimeout
+		}
+
+		if opts[0].SoftTimeout != nil {
+			o.softTimeout = *opts[0].SoftTimeout
+		}
+
+		if opts[0].MaxAge != nil {
+			o.maxAge = *opts[0].MaxAge
+		}
+
+		if opts[0].ConcurrencyKey != nil {
+			o.concurrencyKey = *opts[0].ConcurrencyKey
+		}
+
+		if opts[0].PartitionKey != nil {
+			o.partitionKey = *opts[0].PartitionKey
+		}
+
+		if opts[0].Topic != nil {
+			o.topic = *opts[0].Topic
+		}
+
+		if opts[0].Class != nil {
+			o.class = *opts[0].Class
+		}
+
+		if len(opts[0].Headers) != 0 {
+			o.headers = make(map[string]string, len(opts[0].Headers))
+			for k, v := range opts[0].Headers {
+				o.headers[k] = v
+			}
+		}
 	}
 
 	return o
 }
 
+// MergeOptions combines opts into a single AllowOption.
+// Fields set in later options override the same fields of earlier ones.
+func MergeOptions(opts ...AllowOption) AllowOption {
+	var o AllowOption
+	for _, opt := range opts {
+		if opt.ID != nil {
+			o.ID = opt.ID
+		}
+		if opt.RetryCount != nil {
+			o.RetryCount = opt.RetryCount
+		}
+		if opt.RetryDelay != nil {
+			o.RetryDelay = opt.RetryDelay
+		}
+		if opt.RetryFactor != nil {
+			o.RetryFactor = opt.RetryFactor
+		}
+		if opt.RetryMin != nil {
+			o.RetryMin = opt.RetryMin
+		}
+		if opt.RetryMax != nil {
+			o.RetryMax = opt.RetryMax
+		}
+		if opt.Jitter != nil {
+			o.Jitter = opt.Jitter
+		}
+		if opt.Timeout != nil {
+			o.Timeout = opt.Timeout
+		}
+		if opt.TotalTimeout != nil {
+			o.TotalTimeout = opt.TotalTimeout
+		}
+		if opt.SoftTimeout != nil {
+			o.SoftTimeout = opt.SoftTimeout
+		}
+		if opt.MaxAge != nil {
+			o.MaxAge = opt.MaxAge
+		}
+		if opt.ConcurrencyKey != nil {
+			o.ConcurrencyKey = opt.ConcurrencyKey
+		}
+		if opt.PartitionKey != nil {
+			o.PartitionKey = opt.PartitionKey
+		}
+		if opt.Topic != nil {
+			o.Topic = opt.Topic
+		}
+		if opt.Class != nil {
+			o.Class = opt.Class
+		}
+		// headers are combined, later values win for the same key
+		for k, v := range opt.Headers {
+			if o.Headers == nil {
+				o.Headers = make(map[string]string)
+			}
+			o.Headers[k] = v
+		}
+	}
+
+	return o
+}
+
+// WithHeader returns an AllowOption setting a single header. Several of
+// them can be passed to Queue or combined with MergeOptions.
+func WithHeader(key, value string) AllowOption {
+	return AllowOption{Headers: map[string]string{key: value}}
+}
+
+// WithConcurrencyKey returns an AllowOption setting the concurrency key:
+// jobs sharing it never run at the same time. The ones waiting for the key
+// don't hold a worker.
+func WithConcurrencyKey(key string) AllowOption {
+	return AllowOption{ConcurrencyKey: &key}
+}
+
+// WithPartitionKey returns an AllowOption setting the partition key.
+func WithPartitionKey(key string) AllowOption {
+	return AllowOption{PartitionKey: &key}
+}
+
+// WithClass returns an AllowOption setting the class of the job.
+func WithClass(name string) AllowOption {
+	return AllowOption{Class: &name}
+}
+
+// WithTotalTimeout returns an AllowOption setting the total timeout: all
+// attempts of the job, retry delays included, have to finish within d while
+// Timeout limits each attempt.
+func WithTotalTimeout(d time.Duration) AllowOption {
+	return AllowOption{TotalTimeout: &d}
+}
+
+// WithSoftTimeout returns an AllowOption setting the soft timeout: once d
+// has elapsed the queue reports the job to the callback set by
+// queue.WithSlowTaskCallback and lets it run on until its timeout.
+func WithSoftTimeout(d time.Duration) AllowOption {
+	return AllowOption{SoftTimeout: &d}
+}
+
+// WithMaxAge returns an AllowOption setting the maximum age: a message
+// that waited longer than d in the queue when it is requested is skipped
+// and counted as expired instead of run. Workers implementing
+// core.TTLQueuer get it as the TTL of the message.
+func WithMaxAge(d time.Duration) AllowOption {
+	return AllowOption{MaxAge: &d}
+}
+
 // Int64 is a helper routine that allocates a new int64 value
 func Int64(val int64) *int64 {
 	return &val
@@ -94,3 +282,8 @@ func Time(v time.Duration) *time.Duration {
 func Bool(val bool) *bool {
 	return &val
 }
+
+// String is a helper routine that allocates a new string value
+func String(val string) *string {
+	return &val
+}
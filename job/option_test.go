@@ -1,6 +1,7 @@
 package job
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -26,3 +27,109 @@ func TestOptions(t *testing.T) {
 	assert.Equal(t, 2.0, o.retryFactor)
 	assert.True(t, o.jitter)
 }
+
+func TestTotalTimeoutOption(t *testing.T) {
+	o := NewOptions(
+		AllowOption{
+			TotalTimeout: Time(5 * time.Second),
+		},
+	)
+
+	assert.Equal(t, 5*time.Second, o.totalTimeout)
+	assert.Equal(t, 60*time.Minute, o.timeout)
+
+	o = NewOptions(MergeOptions(WithTotalTimeout(time.Minute), WithTotalTimeout(time.Second)))
+	assert.Equal(t, time.Second, o.totalTimeout)
+
+	m := NewTask(func(context.Context) error { return nil }, WithTotalTimeout(time.Minute))
+	assert.Equal(t, time.Minute, m.TotalTimeout)
+}
+
+func TestSoftTimeoutOption(t *testing.T) {
+	o := NewOptions(MergeOptions(
+		AllowOption{Timeout: Time(time.Minute)},
+		WithSoftTimeout(5*time.Second),
+	))
+
+	assert.Equal(t, 5*time.Second, o.softTimeout)
+	assert.Equal(t, time.Minute, o.timeout)
+
+	m := NewMessage(mockMessage{message: "foo"}, WithSoftTimeout(time.Second))
+	assert.Equal(t, time.Second, m.SoftTimeout)
+}
+
+func TestMaxAgeOption(t *testing.T) {
+	o := NewOptions(MergeOptions(WithMaxAge(time.Hour), WithMaxAge(time.Minute)))
+	assert.Equal(t, time.Minute, o.maxAge)
+
+	m := NewTask(func(context.Context) error { return nil }, WithMaxAge(time.Minute))
+	assert.Equal(t, time.Minute, m.MaxAge)
+}
+
+func TestClassOption(t *testing.T) {
+	o := NewOptions(MergeOptions(WithClass("fast"), WithClass("slow")))
+	assert.Equal(t, "slow", o.class)
+
+	m := NewTask(func(context.Context) error { return nil }, WithClass("slow"))
+	assert.Equal(t, "slow", m.Class)
+}
+
+func TestMergeOptions(t *testing.T) {
+	o := MergeOptions(
+		AllowOption{
+			RetryCount: Int64(3),
+			Timeout:    Time(time.Second),
+		},
+		AllowOption{
+			Timeout: Time(2 * time.Second),
+		},
+	)
+
+	assert.Equal(t, int64(3), *o.RetryCount)
+	assert.Equal(t, 2*time.Second, *o.Timeout)
+	assert.Nil(t, o.RetryDelay)
+}
+
+func TestMergeHeaders(t *testing.T) {
+	first := WithHeader("source", "api")
+	o := MergeOptions(
+		first,
+		WithHeader("content-type", "text/plain"),
+		WithHeader("source", "cron"),
+	)
+
+	assert.Equal(t, map[string]string{
+		"content-type": "text/plain",
+		"source":       "cron",
+	}, o.Headers)
+	// the merged options don't share the map of the first one
+	assert.Equal(t, "api", first.Headers["source"])
+}
+
+func TestTopicOption(t *testing.T) {
+	o := MergeOptions(
+		AllowOption{Topic: String("mail")},
+		AllowOption{Timeout: Time(time.Second)},
+	)
+	assert.Equal(t, "mail", *o.Topic)
+
+	m := NewTask(nil, o)
+	assert.Equal(t, "mail", m.Topic)
+	assert.Equal(t, "mail", Decode(Encode(&m)).Topic)
+}
+
+func TestConcurrencyKeyOption(t *testing.T) {
+	o := MergeOptions(WithConcurrencyKey("user-1"), WithConcurrencyKey("user-2"))
+	assert.Equal(t, "user-2", *o.ConcurrencyKey)
+
+	m := NewTask(func(context.Context) error { return nil }, WithConcurrencyKey("user-1"))
+	assert.Equal(t, "user-1", m.ConcurrencyKey)
+}
+
+func TestPartitionKeyOption(t *testing.T) {
+	o := MergeOptions(WithPartitionKey("account-1"), WithHeader("source", "api"))
+	assert.Equal(t, "account-1", *o.PartitionKey)
+
+	m := NewMessage(&mockMessage{message: "foo"}, o)
+	assert.Equal(t, "account-1", Decode(Encode(&m)).PartitionKey)
+}
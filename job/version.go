@@ -0,0 +1,83 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Version is the version of the encoding of the messages written by this
+// package. Messages encoded before versioning was introduced decode as
+// version 0 and are migrated to the current one.
+const Version = 1
+
+var (
+	aliasMu sync.RWMutex
+	aliases = map[string]string{}
+)
+
+// RegisterFieldAlias makes Decode, and json.Unmarshal, read the JSON field
+// alias as the Message field encoded as field, e.g. "payload" for "body",
+// for messages written by other runtimes. A field present under its own
+// name takes precedence over its aliases. Encoding always uses the names of
+// the current version.
+func RegisterFieldAlias(alias, field string) {
+	aliasMu.Lock()
+	defer aliasMu.Unlock()
+	aliases[alias] = field
+}
+
+// fieldAliases returns a copy of the registered aliases.
+func fieldAliases() map[string]string {
+	aliasMu.RLock()
+	defer aliasMu.RUnlock()
+	if len(aliases) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(aliases))
+	for alias, field := range aliases {
+		m[alias] = field
+	}
+	return m
+}
+
+// UnmarshalJSON decodes a message of any version up to Version, renaming
+// the registered field aliases first. It returns an error wrapping
+// ErrUnsupportedVersion for messages of a later version.
+func (m *Message) UnmarshalJSON(b []byte) error {
+	if aliases := fieldAliases(); aliases != nil {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return err
+		}
+		for alias, field := range aliases {
+			v, ok := fields[alias]
+			if !ok {
+				continue
+			}
+			delete(fields, alias)
+			if _, ok := fields[field]; !ok {
+				fields[field] = v
+			}
+		}
+		var err error
+		if b, err = json.Marshal(fields); err != nil {
+			return err
+		}
+	}
+
+	// decode without calling UnmarshalJSON again
+	type message Message
+	if err := json.Unmarshal(b, (*message)(m)); err != nil {
+		return err
+	}
+
+	switch {
+	case m.Version > Version:
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, m.Version)
+	case m.Version == 0:
+		// version 0 only lacks the version field
+		m.Version = Version
+	}
+	return nil
+}
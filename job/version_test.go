@@ -0,0 +1,57 @@
+package job
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeVersions(t *testing.T) {
+	// written before messages carried a version
+	v0 := []byte(`{"timeout":1000000000,"body":"Zm9v","retry_count":2,"retry_delay":0,` +
+		`"retry_factor":2,"retry_min":0,"retry_max":0,"jitter":false}`)
+	m := Decode(v0)
+	assert.Equal(t, Version, m.Version)
+	assert.Equal(t, "foo", string(m.Body))
+	assert.Equal(t, time.Second, m.Timeout)
+	assert.Equal(t, int64(2), m.RetryCount)
+
+	v1 := []byte(`{"version":1,"id":"job-1","timeout":1000000000,"body":"YmFy"}`)
+	m = Decode(v1)
+	assert.Equal(t, 1, m.Version)
+	assert.Equal(t, "job-1", m.ID)
+	assert.Equal(t, "bar", string(m.Body))
+
+	// new messages are written with the current version
+	msg := NewMessage(mockMessage{message: "foo"})
+	assert.Equal(t, Version, Decode(Encode(&msg)).Version)
+
+	var future Message
+	err := json.Unmarshal([]byte(`{"version":2,"body":"Zm9v"}`), &future)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestRegisterFieldAlias(t *testing.T) {
+	RegisterFieldAlias("payload", "body")
+	RegisterFieldAlias("retries", "retry_count")
+	defer func() {
+		aliasMu.Lock()
+		delete(aliases, "payload")
+		delete(aliases, "retries")
+		aliasMu.Unlock()
+	}()
+
+	m := Decode([]byte(`{"payload":"Zm9v","retries":3,"timeout":1000000000}`))
+	assert.Equal(t, "foo", string(m.Body))
+	assert.Equal(t, int64(3), m.RetryCount)
+	assert.Equal(t, Version, m.Version)
+
+	// the field itself wins over its alias
+	m = Decode([]byte(`{"payload":"Zm9v","body":"YmFy"}`))
+	assert.Equal(t, "bar", string(m.Body))
+
+	// encoding keeps the current names
+	assert.NotContains(t, string(Encode(m)), "payload")
+}
@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/golang-queue/queue/core"
+)
+
+// keepLease extends the lease of task every lease heartbeat while it runs,
+// for workers implementing core.LeaseExtender. The returned function stops
+// the heartbeat and only returns once no extension is in progress.
+func (q *Queue) keepLease(ctx context.Context, task core.TaskMessage) func() {
+	ext, ok := q.worker.(core.LeaseExtender)
+	if !ok || q.leaseEvery <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-q.clock.After(q.leaseEvery):
+				if err := ext.ExtendLease(ctx, task); err != nil {
+					q.logger.Errorf("extend lease of job %q: %s", jobID(task), err.Error())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
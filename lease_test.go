@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type leaseWorker struct {
+	*Ring
+	extended int32
+}
+
+func (w *leaseWorker) ExtendLease(ctx context.Context, task core.TaskMessage) error {
+	atomic.AddInt32(&w.extended, 1)
+	return nil
+}
+
+func TestLeaseHeartbeat(t *testing.T) {
+	clock := newFakeClock()
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	w := &leaseWorker{
+		Ring: NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			close(started)
+			<-finish
+			return nil
+		})),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithClock(clock),
+		WithLeaseHeartbeat(time.Second),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+	defer q.Release()
+
+	assert.NoError(t, q.Queue(mockMessage{message: "slow"}))
+	<-started
+	// the job timeout and the heartbeat wait on the clock
+	assert.Eventually(t, func() bool {
+		return clock.Waiters() == 2
+	}, time.Second, time.Millisecond)
+
+	// no extension before the first heartbeat
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&w.extended))
+
+	for i := int32(1); i <= 3; i++ {
+		clock.Advance(time.Second)
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt32(&w.extended) == i && clock.Waiters() == 2
+		}, time.Second, time.Millisecond)
+	}
+
+	// the heartbeat stops with the job
+	close(finish)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&w.extended))
+}
+
+func TestLeaseHeartbeatDisabled(t *testing.T) {
+	w := &leaseWorker{
+		Ring: NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	q.Release()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&w.extended))
+}
@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+)
+
+// limiter enforces the concurrency keys of the jobs, see
+// job.WithConcurrencyKey, and the limits of their class, see
+// WithClassConcurrency. Jobs over a limit are parked without holding a
+// worker and become ready once the limit allows them, in the order they were
+// parked.
+type limiter struct {
+	sync.Mutex
+	keys    map[string]struct{} // concurrency keys held by a running job
+	limits  map[string]int      // class -> maximum number of running jobs
+	running map[string]int      // class -> number of running jobs
+	parked  []*job.Message      // jobs waiting for a limit
+	ready   []core.TaskMessage  // parked jobs holding their limits, to be started
+	changed chan struct{}       // closed and replaced whenever a limit is freed
+}
+
+func newLimiter(limits map[string]int) *limiter {
+	return &limiter{
+		keys:    make(map[string]struct{}),
+		limits:  limits,
+		running: make(map[string]int),
+		changed: make(chan struct{}),
+	}
+}
+
+// limited returns the job message of task when a limit applies to it.
+func (l *limiter) limited(task core.TaskMessage) (*job.Message, bool) {
+	m, ok := task.(*job.Message)
+	if !ok {
+		return nil, false
+	}
+	_, class := l.limits[m.Class]
+	if m.ConcurrencyKey == "" && !class {
+		return nil, false
+	}
+	return m, true
+}
+
+// admits reports whether the limits of m allow it to run. The caller must
+// hold the lock.
+func (l *limiter) admits(m *job.Message) bool {
+	if _, ok := l.keys[m.ConcurrencyKey]; ok && m.ConcurrencyKey != "" {
+		return false
+	}
+	if n, ok := l.limits[m.Class]; ok && l.running[m.Class] >= n {
+		return false
+	}
+	return true
+}
+
+// take records m as running. The caller must hold the lock.
+func (l *limiter) take(m *job.Message) {
+	if m.ConcurrencyKey != "" {
+		l.keys[m.ConcurrencyKey] = struct{}{}
+	}
+	if _, ok := l.limits[m.Class]; ok {
+		l.running[m.Class]++
+	}
+}
+
+// acquire takes the limits of task and reports whether it may run. A task
+// over a limit is parked and false is returned, it is handed out by next
+// once the limit allows it.
+func (l *limiter) acquire(task core.TaskMessage) bool {
+	m, ok := l.limited(task)
+	if !ok {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if l.admits(m) {
+		l.take(m)
+		return true
+	}
+	l.parked = append(l.parked, m)
+	return false
+}
+
+// wait blocks until the limits of task allow it to run and takes them. It
+// returns ctx.Err() when ctx is done first.
+func (l *limiter) wait(ctx context.Context, task core.TaskMessage) error {
+	m, ok := l.limited(task)
+	if !ok {
+		return nil
+	}
+
+	for {
+		l.Lock()
+		if l.admits(m) {
+			l.take(m)
+			l.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the limits taken for task and makes the parked jobs they
+// held back ready.
+func (l *limiter) release(task core.TaskMessage) {
+	m, ok := l.limited(task)
+	if !ok {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if m.ConcurrencyKey != "" {
+		delete(l.keys, m.ConcurrencyKey)
+	}
+	if _, ok := l.limits[m.Class]; ok {
+		if l.running[m.Class]--; l.running[m.Class] <= 0 {
+			delete(l.running, m.Class)
+		}
+	}
+
+	parked := l.parked[:0]
+	for _, p := range l.parked {
+		if l.admits(p) {
+			l.take(p)
+			l.ready = append(l.ready, p)
+			continue
+		}
+		parked = append(parked, p)
+	}
+	clear(l.parked[len(parked):])
+	l.parked = parked
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// next returns the next ready job, or nil when there is none.
+func (l *limiter) next() core.TaskMessage {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.ready) == 0 {
+		return nil
+	}
+	task := l.ready[0]
+	l.ready[0] = nil
+	l.ready = l.ready[1:]
+	return task
+}
+
+// remove takes the parked job with the given ID out of the limiter and
+// returns it. It reports false when no such job is parked.
+func (l *limiter) remove(id string) (*job.Message, bool) {
+	l.Lock()
+	defer l.Unlock()
+	for i, m := range l.parked {
+		if m.ID == id {
+			l.parked = append(l.parked[:i], l.parked[i+1:]...)
+			return m, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func limitedMessage(id, key, class string) *job.Message {
+	return &job.Message{ID: id, ConcurrencyKey: key, Class: class}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	l := newLimiter(nil)
+	a1 := limitedMessage("a1", "a", "")
+	a2 := limitedMessage("a2", "a", "")
+	a3 := limitedMessage("a3", "a", "")
+	b1 := limitedMessage("b1", "b", "")
+
+	assert.True(t, l.acquire(a1))
+	assert.False(t, l.acquire(a2))
+	assert.False(t, l.acquire(a3))
+	assert.True(t, l.acquire(b1))
+	// jobs without limits are never held back
+	assert.True(t, l.acquire(&job.Message{}))
+	assert.Nil(t, l.next())
+
+	// the parked jobs become ready one by one, in order
+	l.release(a1)
+	assert.Equal(t, a2, l.next())
+	assert.Nil(t, l.next())
+	l.release(a2)
+	assert.Equal(t, a3, l.next())
+	l.release(a3)
+	l.release(b1)
+	assert.Empty(t, l.keys)
+	assert.Empty(t, l.parked)
+}
+
+func TestLimiterClasses(t *testing.T) {
+	l := newLimiter(map[string]int{"slow": 2})
+	s1 := limitedMessage("s1", "", "slow")
+	s2 := limitedMessage("s2", "", "slow")
+	s3 := limitedMessage("s3", "", "slow")
+	// a free class doesn't bypass a held key
+	k1 := limitedMessage("k1", "k", "")
+	k2 := limitedMessage("k2", "k", "slow")
+
+	assert.True(t, l.acquire(s1))
+	assert.True(t, l.acquire(s2))
+	assert.False(t, l.acquire(s3))
+	assert.True(t, l.acquire(k1))
+	assert.False(t, l.acquire(k2))
+
+	l.release(k1)
+	assert.Nil(t, l.next())
+	l.release(s1)
+	assert.Equal(t, s3, l.next())
+	assert.Nil(t, l.next())
+	l.release(s2)
+	assert.Equal(t, k2, l.next())
+	l.release(s3)
+	l.release(k2)
+	assert.Empty(t, l.running)
+}
+
+func TestLimiterWait(t *testing.T) {
+	l := newLimiter(nil)
+	a1 := limitedMessage("a1", "a", "")
+	a2 := limitedMessage("a2", "a", "")
+	assert.True(t, l.acquire(a1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.wait(ctx, a2), context.DeadlineExceeded)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.wait(context.Background(), a2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	l.release(a1)
+	assert.NoError(t, <-done)
+	assert.Contains(t, l.keys, "a")
+}
+
+func TestLimiterRemove(t *testing.T) {
+	l := newLimiter(nil)
+	a1 := limitedMessage("a1", "a", "")
+	a2 := limitedMessage("a2", "a", "")
+	assert.True(t, l.acquire(a1))
+	assert.False(t, l.acquire(a2))
+
+	m, ok := l.remove("a2")
+	assert.True(t, ok)
+	assert.Equal(t, a2, m)
+	_, ok = l.remove("a2")
+	assert.False(t, ok)
+	l.release(a1)
+	assert.Nil(t, l.next())
+}
@@ -2,10 +2,25 @@ package queue
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 )
 
+// LogLevel is the minimum severity written by the default logger.
+type LogLevel int
+
+const (
+	// DebugLevel logs everything, including the task lifecycle.
+	DebugLevel LogLevel = iota
+	// InfoLevel logs informational messages and errors.
+	InfoLevel
+	// ErrorLevel logs errors only.
+	ErrorLevel
+	// FatalLevel logs fatal messages only.
+	FatalLevel
+)
+
 // Logger interface is used throughout gorush
 type Logger interface {
 	Infof(format string, args ...interface{})
@@ -16,16 +31,36 @@ type Logger interface {
 	Fatal(args ...interface{})
 }
 
+// DebugLogger is implemented by loggers that also write debug messages,
+// e.g. the task lifecycle. The queue only logs them to such loggers.
+type DebugLogger interface {
+	Debugf(format string, args ...interface{})
+	Debug(args ...interface{})
+}
+
 // NewLogger for simple logger.
 func NewLogger() Logger {
+	return NewLevelLogger(InfoLevel)
+}
+
+// NewLevelLogger for simple logger dropping messages below level.
+func NewLevelLogger(level LogLevel) Logger {
+	return newLevelLogger(os.Stderr, level)
+}
+
+func newLevelLogger(w io.Writer, level LogLevel) Logger {
 	return defaultLogger{
-		infoLogger:  log.New(os.Stderr, "INFO: ", log.Ldate|log.Ltime),
-		errorLogger: log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime),
-		fatalLogger: log.New(os.Stderr, "FATAL: ", log.Ldate|log.Ltime),
+		level:       level,
+		debugLogger: log.New(w, "DEBUG: ", log.Ldate|log.Ltime),
+		infoLogger:  log.New(w, "INFO: ", log.Ldate|log.Ltime),
+		errorLogger: log.New(w, "ERROR: ", log.Ldate|log.Ltime),
+		fatalLogger: log.New(w, "FATAL: ", log.Ldate|log.Ltime),
 	}
 }
 
 type defaultLogger struct {
+	level       LogLevel
+	debugLogger *log.Logger
 	infoLogger  *log.Logger
 	errorLogger *log.Logger
 	fatalLogger *log.Logger
@@ -41,11 +76,24 @@ func (l defaultLogger) logWithCaller(logger *log.Logger, args ...interface{}) {
 	logger.Println(stack, fmt.Sprint(args...))
 }
 
+func (l defaultLogger) Debugf(format string, args ...interface{}) {
+	if l.level > DebugLevel {
+		return
+	}
+	l.debugLogger.Printf(format, args...)
+}
+
 func (l defaultLogger) Infof(format string, args ...interface{}) {
+	if l.level > InfoLevel {
+		return
+	}
 	l.infoLogger.Printf(format, args...)
 }
 
 func (l defaultLogger) Errorf(format string, args ...interface{}) {
+	if l.level > ErrorLevel {
+		return
+	}
 	l.errorLogger.Printf(format, args...)
 }
 
@@ -53,11 +101,24 @@ func (l defaultLogger) Fatalf(format string, args ...interface{}) {
 	l.logWithCallerf(l.fatalLogger, format, args...)
 }
 
+func (l defaultLogger) Debug(args ...interface{}) {
+	if l.level > DebugLevel {
+		return
+	}
+	l.debugLogger.Println(fmt.Sprint(args...))
+}
+
 func (l defaultLogger) Info(args ...interface{}) {
+	if l.level > InfoLevel {
+		return
+	}
 	l.infoLogger.Println(fmt.Sprint(args...))
 }
 
 func (l defaultLogger) Error(args ...interface{}) {
+	if l.level > ErrorLevel {
+		return
+	}
 	l.errorLogger.Println(fmt.Sprint(args...))
 }
 
@@ -73,9 +134,11 @@ func NewEmptyLogger() Logger {
 // EmptyLogger no meesgae logger
 type emptyLogger struct{}
 
+func (l emptyLogger) Debugf(format string, args ...interface{}) {}
 func (l emptyLogger) Infof(format string, args ...interface{})  {}
 func (l emptyLogger) Errorf(format string, args ...interface{}) {}
 func (l emptyLogger) Fatalf(format string, args ...interface{}) {}
+func (l emptyLogger) Debug(args ...interface{})                 {}
 func (l emptyLogger) Info(args ...interface{})                  {}
 func (l emptyLogger) Error(args ...interface{})                 {}
 func (l emptyLogger) Fatal(args ...interface{})                 {}
@@ -1,5 +1,12 @@
 package queue
 
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
 func ExampleNewEmptyLogger() {
 	l := NewEmptyLogger()
 	l.Info("test")
@@ -10,3 +17,45 @@ func ExampleNewEmptyLogger() {
 	l.Fatalf("test")
 	// Output:
 }
+
+func TestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLevelLogger(&buf, InfoLevel)
+
+	l.(DebugLogger).Debug("debug")
+	l.(DebugLogger).Debugf("debug %d", 1)
+	assert.Empty(t, buf.String())
+
+	l.Info("info")
+	l.Infof("info %d", 1)
+	l.Error("error")
+	l.Errorf("error %d", 1)
+	out := buf.String()
+	assert.Contains(t, out, "INFO: ")
+	assert.Contains(t, out, "info 1")
+	assert.Contains(t, out, "ERROR: ")
+	assert.Contains(t, out, "error 1")
+
+	buf.Reset()
+	l = newLevelLogger(&buf, ErrorLevel)
+	l.Info("info")
+	l.Infof("info %d", 1)
+	assert.Empty(t, buf.String())
+	l.Errorf("error %d", 1)
+	assert.Contains(t, buf.String(), "error 1")
+
+	buf.Reset()
+	l = newLevelLogger(&buf, DebugLevel)
+	l.(DebugLogger).Debugf("debug %d", 1)
+	assert.Contains(t, buf.String(), "DEBUG: ")
+	assert.Contains(t, buf.String(), "debug 1")
+}
+
+func TestWithLogLevel(t *testing.T) {
+	o := NewOptions(WithLogLevel(ErrorLevel))
+	assert.Equal(t, ErrorLevel, o.logger.(defaultLogger).level)
+
+	// a custom logger is kept as is
+	o = NewOptions(WithLogLevel(ErrorLevel), WithLogger(NewEmptyLogger()))
+	assert.Equal(t, NewEmptyLogger(), o.logger)
+}
@@ -1,6 +1,10 @@
 package queue
 
-import "sync/atomic"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Metric interface
 type Metric interface {
@@ -16,13 +20,118 @@ type Metric interface {
 	IncSubmittedTask()
 }
 
-var _ Metric = (*metric)(nil)
+// The interfaces below are optional counters of a Metric, which the queue
+// detects with a type assertion. The counters a custom Metric leaves out
+// are skipped and the matching Queue methods return zero.
+
+// RetryMetric is implemented by metrics counting retries and dead letters.
+type RetryMetric interface {
+	RetriedTasks() uint64
+	DeadLetteredTasks() uint64
+	IncRetriedTask()
+	IncDeadLetteredTask()
+}
+
+// DropMetric is implemented by metrics counting the messages dropped
+// because they could not be decoded.
+type DropMetric interface {
+	DroppedTasks() uint64
+	IncDroppedTask()
+}
+
+// ExpiryMetric is implemented by metrics counting the jobs skipped after
+// waiting longer than their max age.
+type ExpiryMetric interface {
+	ExpiredTasks() uint64
+	IncExpiredTask()
+}
+
+// WaitTimeMetric is implemented by metrics measuring how long jobs wait in
+// the queue before they start.
+type WaitTimeMetric interface {
+	ObserveWaitTime(d time.Duration)
+	AverageWaitTime() time.Duration
+}
+
+// FailureTypeMetric is implemented by metrics counting the failures by
+// type, see the Failure constants.
+type FailureTypeMetric interface {
+	IncFailureType(kind string)
+	FailuresByType() map[string]uint64
+}
+
+// Failure types counted by FailureTypeMetric.FailuresByType.
+const (
+	// FailureTimeout the job ran out of time
+	FailureTimeout = "timeout"
+	// FailurePanic the job panicked
+	FailurePanic = "panic"
+	// FailureTask the job returned an error
+	FailureTask = "task"
+	// FailureDecode the message could not be decoded
+	FailureDecode = "decode"
+)
+
+var (
+	_ Metric            = (*metric)(nil)
+	_ RetryMetric       = (*metric)(nil)
+	_ DropMetric        = (*metric)(nil)
+	_ ExpiryMetric      = (*metric)(nil)
+	_ WaitTimeMetric    = (*metric)(nil)
+	_ FailureTypeMetric = (*metric)(nil)
+	_ Metric            = noopMetric{}
+)
+
+// queueMetric is the Metric of a queue along with its optional counters,
+// the ones it doesn't implement discard everything.
+type queueMetric struct {
+	Metric
+	RetryMetric
+	DropMetric
+	ExpiryMetric
+	WaitTimeMetric
+	FailureTypeMetric
+}
+
+func newQueueMetric(m Metric) *queueMetric {
+	qm := &queueMetric{
+		Metric:            m,
+		RetryMetric:       noopMetric{},
+		DropMetric:        noopMetric{},
+		ExpiryMetric:      noopMetric{},
+		WaitTimeMetric:    noopMetric{},
+		FailureTypeMetric: noopMetric{},
+	}
+	if r, ok := m.(RetryMetric); ok {
+		qm.RetryMetric = r
+	}
+	if d, ok := m.(DropMetric); ok {
+		qm.DropMetric = d
+	}
+	if e, ok := m.(ExpiryMetric); ok {
+		qm.ExpiryMetric = e
+	}
+	if w, ok := m.(WaitTimeMetric); ok {
+		qm.WaitTimeMetric = w
+	}
+	if f, ok := m.(FailureTypeMetric); ok {
+		qm.FailureTypeMetric = f
+	}
+	return qm
+}
 
 type metric struct {
 	busyWorkers    int64
 	successTasks   uint64
 	failureTasks   uint64
 	submittedTasks uint64
+	retriedTasks   uint64
+	deadLettered   uint64
+	droppedTasks   uint64
+	expiredTasks   uint64
+	waitTime       int64
+	waitedTasks    int64
+	failureTypes   sync.Map // failure type -> *uint64
 }
 
 // NewMetric for default metric structure
@@ -69,3 +178,90 @@ func (m *metric) SubmittedTasks() uint64 {
 func (m *metric) CompletedTasks() uint64 {
 	return atomic.LoadUint64(&m.successTasks) + atomic.LoadUint64(&m.failureTasks)
 }
+
+func (m *metric) IncRetriedTask() {
+	atomic.AddUint64(&m.retriedTasks, 1)
+}
+
+func (m *metric) IncDeadLetteredTask() {
+	atomic.AddUint64(&m.deadLettered, 1)
+}
+
+func (m *metric) RetriedTasks() uint64 {
+	return atomic.LoadUint64(&m.retriedTasks)
+}
+
+func (m *metric) DeadLetteredTasks() uint64 {
+	return atomic.LoadUint64(&m.deadLettered)
+}
+
+func (m *metric) IncDroppedTask() {
+	atomic.AddUint64(&m.droppedTasks, 1)
+}
+
+func (m *metric) DroppedTasks() uint64 {
+	return atomic.LoadUint64(&m.droppedTasks)
+}
+
+func (m *metric) IncExpiredTask() {
+	atomic.AddUint64(&m.expiredTasks, 1)
+}
+
+func (m *metric) ExpiredTasks() uint64 {
+	return atomic.LoadUint64(&m.expiredTasks)
+}
+
+func (m *metric) ObserveWaitTime(d time.Duration) {
+	atomic.AddInt64(&m.waitTime, int64(d))
+	atomic.AddInt64(&m.waitedTasks, 1)
+}
+
+func (m *metric) AverageWaitTime() time.Duration {
+	n := atomic.LoadInt64(&m.waitedTasks)
+	if n == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&m.waitTime) / n)
+}
+
+func (m *metric) IncFailureType(kind string) {
+	n, _ := m.failureTypes.LoadOrStore(kind, new(uint64))
+	atomic.AddUint64(n.(*uint64), 1)
+}
+
+func (m *metric) FailuresByType() map[string]uint64 {
+	failures := map[string]uint64{}
+	m.failureTypes.Range(func(kind, n interface{}) bool {
+		failures[kind.(string)] = atomic.LoadUint64(n.(*uint64))
+		return true
+	})
+	return failures
+}
+
+// noopMetric is the Metric discarding everything, see WithMetricsDisabled.
+type noopMetric struct{}
+
+func (noopMetric) IncBusyWorker()                 {}
+func (noopMetric) DecBusyWorker()                 {}
+func (noopMetric) BusyWorkers() int64             { return 0 }
+func (noopMetric) SuccessTasks() uint64           { return 0 }
+func (noopMetric) FailureTasks() uint64           { return 0 }
+func (noopMetric) SubmittedTasks() uint64         { return 0 }
+func (noopMetric) CompletedTasks() uint64         { return 0 }
+func (noopMetric) IncSuccessTask()                {}
+func (noopMetric) IncFailureTask()                {}
+func (noopMetric) IncSubmittedTask()              {}
+func (noopMetric) RetriedTasks() uint64           { return 0 }
+func (noopMetric) DeadLetteredTasks() uint64      { return 0 }
+func (noopMetric) IncRetriedTask()                {}
+func (noopMetric) IncDeadLetteredTask()           {}
+func (noopMetric) DroppedTasks() uint64           { return 0 }
+func (noopMetric) IncDroppedTask()                {}
+func (noopMetric) ExpiredTasks() uint64           { return 0 }
+func (noopMetric) IncExpiredTask()                {}
+func (noopMetric) ObserveWaitTime(time.Duration)  {}
+func (noopMetric) AverageWaitTime() time.Duration { return 0 }
+func (noopMetric) IncFailureType(string)          {}
+func (noopMetric) FailuresByType() map[string]uint64 {
+	return map[string]uint64{}
+}
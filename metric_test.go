@@ -3,10 +3,13 @@ package queue
 import (
 	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,7 +45,7 @@ func TestMetricData(t *testing.T) {
 	assert.NoError(t, q.Queue(mockMessage{
 		message: "foo4",
 	}))
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(50 * time.Millisecond)
 	assert.Equal(t, uint64(4), q.SubmittedTasks())
 	assert.Equal(t, uint64(2), q.SuccessTasks())
@@ -50,3 +53,235 @@ func TestMetricData(t *testing.T) {
 	assert.Equal(t, uint64(4), q.CompletedTasks())
 	q.Release()
 }
+
+func TestRetryAndDeadLetterMetric(t *testing.T) {
+	var deadLetters []string
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+		WithDeadLetter(func(task core.TaskMessage, err error) {
+			deadLetters = append(deadLetters, err.Error())
+		}),
+	)
+	assert.NoError(t, err)
+
+	// succeeds at once
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	// fails twice, then succeeds
+	count := 0
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		count++
+		if count < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, job.AllowOption{
+		RetryCount: job.Int64(2),
+		RetryDelay: job.Time(10 * time.Millisecond),
+	}))
+	// exhausts its retries
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return errors.New("exhausted")
+	}, job.AllowOption{
+		RetryCount: job.Int64(1),
+		RetryDelay: job.Time(10 * time.Millisecond),
+	}))
+
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, uint64(2), q.SuccessTasks())
+	assert.Equal(t, uint64(1), q.FailureTasks())
+	assert.Equal(t, uint64(3), q.RetriedTasks())
+	assert.Equal(t, uint64(1), q.DeadLetteredTasks())
+	assert.Equal(t, []string{"exhausted"}, deadLetters)
+}
+
+func TestAverageWaitTime(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), q.AverageWaitTime())
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			return nil
+		}))
+	}
+	// the jobs wait for the queue to start
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, uint64(4), q.SuccessTasks())
+	assert.GreaterOrEqual(t, q.AverageWaitTime(), 50*time.Millisecond)
+	assert.Less(t, q.AverageWaitTime(), time.Second)
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithMetricsDisabled(),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	var ran int32
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		}))
+	}
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		atomic.AddInt32(&ran, 1)
+		return errors.New("failed")
+	}))
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	// the jobs ran, but nothing was counted
+	assert.Equal(t, int32(6), atomic.LoadInt32(&ran))
+	assert.Equal(t, uint64(0), q.SubmittedTasks())
+	assert.Equal(t, uint64(0), q.SuccessTasks())
+	assert.Equal(t, uint64(0), q.FailureTasks())
+	assert.Equal(t, uint64(0), q.CompletedTasks())
+	assert.Equal(t, int64(0), q.BusyWorkers())
+	assert.Equal(t, time.Duration(0), q.AverageWaitTime())
+}
+
+// countingMetric is a Metric recording how often the queue calls into it.
+type countingMetric struct {
+	Metric
+	calls sync.Map // method name -> *int32
+}
+
+func (m *countingMetric) count(name string) {
+	n, _ := m.calls.LoadOrStore(name, new(int32))
+	atomic.AddInt32(n.(*int32), 1)
+}
+
+func (m *countingMetric) Calls(name string) int32 {
+	n, ok := m.calls.Load(name)
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt32(n.(*int32))
+}
+
+func (m *countingMetric) IncSubmittedTask() {
+	m.count("IncSubmittedTask")
+	m.Metric.IncSubmittedTask()
+}
+
+func (m *countingMetric) IncSuccessTask() {
+	m.count("IncSuccessTask")
+	m.Metric.IncSuccessTask()
+}
+
+func (m *countingMetric) IncFailureTask() {
+	m.count("IncFailureTask")
+	m.Metric.IncFailureTask()
+}
+
+func (m *countingMetric) IncBusyWorker() {
+	m.count("IncBusyWorker")
+	m.Metric.IncBusyWorker()
+}
+
+func TestCustomMetric(t *testing.T) {
+	m := &countingMetric{Metric: NewMetric()}
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithMetric(m),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return errors.New("failed")
+	}))
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, int32(2), m.Calls("IncSubmittedTask"))
+	assert.Equal(t, int32(2), m.Calls("IncBusyWorker"))
+	assert.Equal(t, int32(1), m.Calls("IncSuccessTask"))
+	assert.Equal(t, int32(1), m.Calls("IncFailureTask"))
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+	assert.Equal(t, uint64(1), m.SuccessTasks())
+}
+
+// retryMetric is a Metric implementing RetryMetric only of the optional
+// counters.
+type retryMetric struct {
+	Metric
+	RetryMetric
+}
+
+func TestCustomMetricOptionalCounters(t *testing.T) {
+	failing := func(ctx context.Context) error {
+		return errors.New("failed")
+	}
+	retry := job.AllowOption{
+		RetryCount: job.Int64(1),
+		RetryDelay: job.Time(time.Millisecond),
+	}
+
+	// a Metric without the optional counters still works
+	m := &countingMetric{Metric: NewMetric()}
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithMetric(m),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.QueueTask(failing, retry))
+	assert.NoError(t, q.Start())
+	q.Release()
+	assert.Equal(t, uint64(1), q.FailureTasks())
+	assert.Equal(t, uint64(0), q.RetriedTasks())
+	assert.Equal(t, map[string]uint64{}, q.FailuresByType())
+	assert.Equal(t, time.Duration(0), q.AverageWaitTime())
+
+	// the counters it implements are used
+	base := NewMetric()
+	q, err = NewQueue(
+		WithWorker(NewRing()),
+		WithMetric(retryMetric{Metric: base, RetryMetric: base.(RetryMetric)}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.QueueTask(failing, retry))
+	assert.NoError(t, q.Start())
+	q.Release()
+	assert.Equal(t, uint64(1), q.FailureTasks())
+	assert.Equal(t, uint64(1), q.RetriedTasks())
+	assert.Equal(t, map[string]uint64{}, q.FailuresByType())
+}
+
+func TestMetricNotShared(t *testing.T) {
+	a, err := NewQueue(WithWorker(NewRing()), WithLogger(NewEmptyLogger()))
+	assert.NoError(t, err)
+	b, err := NewQueue(WithWorker(NewRing()), WithLogger(NewEmptyLogger()))
+	assert.NoError(t, err)
+
+	assert.NoError(t, a.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	assert.Equal(t, uint64(1), a.SubmittedTasks())
+	assert.Equal(t, uint64(0), b.SubmittedTasks())
+	assert.NoError(t, a.Start())
+	a.Release()
+	b.Release()
+}
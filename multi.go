@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"errors"
+	"io"
+	"maps"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+)
+
+var _ core.Worker = (*MultiWorker)(nil)
+
+// MultiWorker fans every queued task out to several workers and consumes
+// from all of them, e.g. to publish to a broker and keep a local audit copy.
+//
+// Each worker receives its own copy of a job message, so a message queued
+// once is handled once per worker. The first worker gets the message itself,
+// a caller waiting on the job, e.g. with Queue.QueueTaskAndWait, follows its
+// handling by that worker. The payload of a streamed message is read once
+// and handed to every worker. Queue fails when any worker rejects the
+// task, the workers that accepted it keep their copy; the effective capacity
+// is therefore the smallest capacity of the workers. A message is run by the
+// worker it was requested from; other task types are run by the first worker.
+type MultiWorker struct {
+	*workerSet
+}
+
+// NewMultiWorker returns a worker fanning tasks out to workers.
+func NewMultiWorker(workers ...core.Worker) *MultiWorker {
+	return &MultiWorker{
+		workerSet: &workerSet{workers: workers},
+	}
+}
+
+// Queue adds task to every worker and returns the errors of the workers
+// that rejected it, joined.
+func (w *MultiWorker) Queue(task core.TaskMessage) error {
+	// copy the message before the first worker can start handling it
+	tasks := make([]core.TaskMessage, len(w.workers))
+	for i := range tasks {
+		tasks[i] = task
+	}
+	if m, ok := task.(*job.Message); ok {
+		if m.Stream != nil {
+			body, err := io.ReadAll(m.Stream)
+			if err != nil {
+				return err
+			}
+			m.Body, m.Stream = body, nil
+		}
+		for i := 1; i < len(tasks); i++ {
+			tasks[i] = copyMessage(m)
+		}
+	}
+
+	errs := make([]error, 0, len(w.workers))
+	for i, worker := range w.workers {
+		if err := worker.Queue(tasks[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyMessage returns a copy of m sharing no mutable state with it.
+func copyMessage(m *job.Message) *job.Message {
+	c := *m
+	if m.Body != nil {
+		c.Body = append([]byte(nil), m.Body...)
+	}
+	c.Headers = maps.Clone(m.Headers)
+	return &c
+}
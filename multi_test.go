@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+	"github.com/golang-queue/queue/queuetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiWorkerFanOut(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[string][]string)
+	record := func(name string) Option {
+		return WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			mu.Lock()
+			got[name] = append(got[name], string(m.Payload()))
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	w := NewMultiWorker(
+		NewRing(record("broker")),
+		NewRing(record("audit")),
+	)
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	assert.NoError(t, q.Queue(mockMessage{message: "bar"}))
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 4
+	}, time.Second, 5*time.Millisecond)
+	q.Release()
+
+	assert.ElementsMatch(t, []string{"foo", "bar"}, got["broker"])
+	assert.ElementsMatch(t, []string{"foo", "bar"}, got["audit"])
+}
+
+func TestMultiWorkerQueueError(t *testing.T) {
+	full := NewRing(WithQueueSize(1))
+	open := NewRing()
+	w := NewMultiWorker(full, open)
+
+	assert.NoError(t, w.Queue(mockMessage{message: "foo"}))
+	err := w.Queue(mockMessage{message: "bar"})
+	assert.ErrorIs(t, err, ErrMaxCapacity)
+
+	// the worker with room still got the task
+	for _, want := range []string{"foo", "bar"} {
+		task, err := open.Request()
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(task.Payload()))
+	}
+}
+
+func TestMultiWorkerRequest(t *testing.T) {
+	w := NewMultiWorker(NewRing(), NewRing())
+
+	_, err := w.Request()
+	assert.Equal(t, ErrNoTaskInQueue, err)
+
+	assert.NoError(t, w.Shutdown())
+	_, err = w.Request()
+	assert.Equal(t, ErrQueueHasBeenClosed, err)
+}
+
+func TestMultiWorkerRequestTaskWithError(t *testing.T) {
+	errAck := errors.New("ack failed")
+	fake := queuetest.NewFakeWorker()
+	fake.Return(mockMessage{message: "foo"}, errAck)
+	w := NewMultiWorker(NewRing(), fake)
+
+	// the task is handed out along with the error instead of dropped
+	task, err := w.Request()
+	assert.ErrorIs(t, err, errAck)
+	if assert.NotNil(t, task) {
+		assert.Equal(t, "foo", string(task.Payload()))
+	}
+}
+
+func TestMultiWorkerQueueTaskAndWait(t *testing.T) {
+	var runs int32
+	q, err := NewQueue(
+		WithWorker(NewMultiWorker(NewRing(), NewRing())),
+		WithWorkerCount(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	q.Start()
+	defer q.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// the caller follows the job handed to the first worker
+	assert.NoError(t, q.QueueTaskAndWait(ctx, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&runs) == 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestMultiWorkerCopiesMessage(t *testing.T) {
+	first, second := NewRing(), NewRing()
+	w := NewMultiWorker(first, second)
+
+	m := job.NewMessage(&mockMessage{message: "foo"})
+	m.Body = []byte("foo")
+	m.Headers = map[string]string{"k": "v"}
+	assert.NoError(t, w.Queue(&m))
+
+	got, err := first.Request()
+	assert.NoError(t, err)
+	assert.Same(t, &m, got)
+
+	got, err = second.Request()
+	assert.NoError(t, err)
+	c := got.(*job.Message)
+	assert.NotSame(t, &m, c)
+	assert.Equal(t, m.Headers, c.Headers)
+	assert.Equal(t, m.Body, c.Body)
+
+	// the copy shares no mutable state with the original
+	m.Headers["k"] = "changed"
+	m.Body[0] = 'x'
+	assert.Equal(t, "v", c.Headers["k"])
+	assert.Equal(t, "foo", string(c.Body))
+}
+
+func TestMultiWorkerStream(t *testing.T) {
+	first, second := NewRing(), NewRing()
+	w := NewMultiWorker(first, second)
+
+	m := job.NewMessage(&mockMessage{message: "foo"})
+	m.Body, m.Stream = nil, strings.NewReader("streamed")
+	assert.NoError(t, w.Queue(&m))
+
+	// the stream is read once and every worker gets the payload
+	for _, r := range []*Ring{first, second} {
+		got, err := r.Request()
+		assert.NoError(t, err)
+		assert.Equal(t, "streamed", string(got.Payload()))
+	}
+}
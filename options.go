@@ -2,17 +2,92 @@ package queue
 
 import (
 	"context"
+	"fmt"
 	"runtime"
+	"time"
 
 	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
 )
 
 var (
-	defaultCapacity    = 0
-	defaultWorkerCount = int64(runtime.NumCPU())
-	defaultNewLogger   = NewLogger()
-	defaultFn          = func(context.Context, core.TaskMessage) error { return nil }
-	defaultMetric      = NewMetric()
+	defaultCapacity     = 0
+	defaultWorkerCount  = int64(runtime.NumCPU())
+	numCPU              = runtime.NumCPU
+	defaultFn           = func(context.Context, core.TaskMessage) error { return ErrMissingRunFunc }
+	defaultPollInterval = time.Second
+
+	defaultThroughputWindow = 10 * time.Second
+
+	defaultAckBatchSize     = 100
+	defaultAckFlushInterval = time.Second
+
+	defaultBackpressureWindow    = 5 * time.Second
+	defaultBackpressureThreshold = 0.9
+)
+
+// PanicPolicy decides what happens when a task panics.
+type PanicPolicy int
+
+const (
+	// PanicRecover logs the panic and counts the task as failed.
+	PanicRecover PanicPolicy = iota
+	// PanicCrash logs the panic and re-raises it, crashing the process.
+	PanicCrash
+)
+
+// OverflowPolicy decides what the ring does with a new task once it is full.
+type OverflowPolicy int
+
+const (
+	// OverflowReject fails the new task with ErrMaxCapacity or ErrMaxBytes.
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropOldest evicts buffered tasks from the front to make room.
+	// The queue fails the evicted jobs with ErrTaskDropped.
+	OverflowDropOldest
+	// OverflowDropNewest discards the new task and fails it with
+	// ErrTaskDropped.
+	OverflowDropNewest
+)
+
+// ShutdownMode decides how Queue.Shutdown treats the pending work.
+type ShutdownMode int
+
+const (
+	// ShutdownImmediate shuts the worker down and cancels the running jobs
+	// that don't finish before their timeout.
+	ShutdownImmediate ShutdownMode = iota
+	// ShutdownDrain stops accepting jobs, waits for the buffered and running
+	// ones to finish, then shuts the worker down.
+	ShutdownDrain
+)
+
+// RetryMode decides how a failed job with retries left is retried.
+type RetryMode int
+
+const (
+	// RetryInProcess retries the job on the same worker after the retry
+	// delay, keeping the worker busy meanwhile.
+	RetryInProcess RetryMode = iota
+	// RetryRequeue frees the worker and submits the job to the queue again
+	// after the retry delay, with its RetryCount decremented. Each run gets
+	// the full timeout, TotalTimeout doesn't span the retries.
+	RetryRequeue
+)
+
+// DecodeErrorPolicy decides what happens to a message handed out by the
+// worker that can't be decoded into a job message.
+type DecodeErrorPolicy int
+
+const (
+	// DecodeFail counts the message as failed and returns the error to its
+	// waiters, it is not sent to the dead-letter sink.
+	DecodeFail DecodeErrorPolicy = iota
+	// DecodeDrop discards the message, counted by Queue.DroppedTasks.
+	DecodeDrop
+	// DecodeDeadLetter counts the message as failed and forwards its raw
+	// bytes to the sink set by WithDeadLetter.
+	DecodeDeadLetter
 )
 
 // An Option configures a mutex.
@@ -38,6 +113,40 @@ func WithWorkerCount(num int64) Option {
 	})
 }
 
+// WithClassConcurrency set the maximum number of jobs of a class, set by
+// job.WithClass, handled at the same time. Classes not in limits, and jobs
+// without class, are only bound by the worker count and WithMaxInFlight.
+// Jobs over their limit wait without holding a worker.
+func WithClassConcurrency(limits map[string]int) Option {
+	return OptionFunc(func(q *Options) {
+		q.classConcurrency = make(map[string]int, len(limits))
+		for class, n := range limits {
+			q.classConcurrency[class] = n
+		}
+	})
+}
+
+// WithCPUScaling caps the number of jobs run at once to multiplier times
+// the number of CPUs, at least one, whatever the worker count. Use a
+// multiplier above one for jobs mostly waiting on I/O. Zero, the default,
+// disables the cap.
+func WithCPUScaling(multiplier float64) Option {
+	return OptionFunc(func(q *Options) {
+		if multiplier < 0 {
+			multiplier = 0
+		}
+		q.cpuMultiplier = multiplier
+	})
+}
+
+// WithMaxInFlight set the maximum number of jobs handled at the same time,
+// independently of the worker count. Zero means no limit.
+func WithMaxInFlight(num int) Option {
+	return OptionFunc(func(q *Options) {
+		q.maxInFlight = num
+	})
+}
+
 // WithQueueSize set worker count
 func WithQueueSize(num int) Option {
 	return OptionFunc(func(q *Options) {
@@ -45,6 +154,188 @@ func WithQueueSize(num int) Option {
 	})
 }
 
+// WithMaxBytes set the maximum summed payload size buffered by the ring,
+// zero means no limit
+func WithMaxBytes(num int) Option {
+	return OptionFunc(func(q *Options) {
+		q.maxBytes = num
+	})
+}
+
+// WithMaxPayloadSize set the largest payload, in bytes, a submitted message
+// may carry. Larger ones are refused with ErrPayloadTooLarge before reaching
+// the worker. Streamed payloads are only measured when they are read for a
+// remote worker. Zero means no limit.
+func WithMaxPayloadSize(size int) Option {
+	return OptionFunc(func(q *Options) {
+		q.maxPayloadSize = size
+	})
+}
+
+// WithLeaseHeartbeat set how often the lease of a running job is extended
+// for workers implementing core.LeaseExtender. Choose it well below the
+// lease duration of the backend. Zero disables the heartbeat.
+func WithLeaseHeartbeat(interval time.Duration) Option {
+	return OptionFunc(func(q *Options) {
+		q.leaseHeartbeat = interval
+	})
+}
+
+// WithRequeueOnFailure pushes a job that failed, once its retries are
+// used up, back onto the tail of the queue after delay instead of failing it,
+// so that the jobs queued meanwhile run first. A job is requeued at most
+// maxRequeues times, its retries are not renewed. Only job messages held by
+// a local worker are requeued, cancelled jobs never are.
+func WithRequeueOnFailure(delay time.Duration, maxRequeues int) Option {
+	return OptionFunc(func(q *Options) {
+		q.requeueDelay = delay
+		q.maxRequeues = maxRequeues
+	})
+}
+
+// WithSlowTaskCallback set the function called when a job outlives its
+// soft timeout, set by job.WithSoftTimeout, before its timeout. It gets the
+// time elapsed since the job started, the job keeps running.
+func WithSlowTaskCallback(fn func(task core.TaskMessage, elapsed time.Duration)) Option {
+	return OptionFunc(func(q *Options) {
+		q.slowTaskFn = fn
+	})
+}
+
+// WithDynamicTimeout set the function computing the timeout of each job
+// from its message when it starts, e.g. from the payload size, overriding
+// its Timeout. The message is a *job.Message, a core.TaskMessage. A job
+// whose computed timeout isn't positive fails with ErrInvalidTimeout
+// without running.
+func WithDynamicTimeout(fn func(msg core.QueuedMessage) time.Duration) Option {
+	return OptionFunc(func(q *Options) {
+		q.dynamicTimeout = fn
+	})
+}
+
+// WithAckBatchSize set how many successful tasks are acknowledged at once
+// to a worker implementing core.BatchAcker
+func WithAckBatchSize(num int) Option {
+	return OptionFunc(func(q *Options) {
+		if num <= 0 {
+			num = defaultAckBatchSize
+		}
+		q.ackBatchSize = num
+	})
+}
+
+// WithAckFlushInterval set how long successful tasks wait at most to be
+// acknowledged to a worker implementing core.BatchAcker, even if their
+// batch is not full
+func WithAckFlushInterval(d time.Duration) Option {
+	return OptionFunc(func(q *Options) {
+		if d <= 0 {
+			d = defaultAckFlushInterval
+		}
+		q.ackFlushInterval = d
+	})
+}
+
+// WithResultSummarizer set the function turning a handled task and its
+// error into a line logged at info level, e.g. to log the order ID parsed
+// from the payload. Returning an empty string skips the log line.
+func WithResultSummarizer(fn func(msg core.QueuedMessage, err error) string) Option {
+	return OptionFunc(func(q *Options) {
+		q.resultSummarizer = fn
+	})
+}
+
+// WithManualDispatch lets the caller drive the dispatch, e.g. from its own
+// event loop: Start doesn't run the loop requesting tasks, each call of
+// Queue.Tick dispatches one instead. The worker should be emptied with Tick
+// before the queue is shut down, a Ring waits for its buffered tasks to be
+// requested.
+func WithManualDispatch() Option {
+	return OptionFunc(func(q *Options) {
+		q.manualDispatch = true
+	})
+}
+
+// WithInlineExecution runs the jobs without timeout, neither Timeout nor
+// TotalTimeout set, on the worker goroutine instead of a goroutine of their
+// own, saving its cost for tiny tasks. Such jobs have no deadline and are not
+// cancelled by a shutdown. Jobs with a timeout are not affected, without
+// this option a zero timeout expires at once.
+func WithInlineExecution() Option {
+	return OptionFunc(func(q *Options) {
+		q.inlineExecution = true
+	})
+}
+
+// WithOverflowPolicy set what the ring does with a new task once it is full.
+// Dropped tasks are never run and are counted by Ring.DroppedTasks, the
+// callers waiting on them get ErrTaskDropped.
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return OptionFunc(func(q *Options) {
+		q.overflowPolicy = p
+	})
+}
+
+// WithEventBuffer set how many task outcomes Queue.Events buffers
+// before new ones are dropped
+func WithEventBuffer(num int) Option {
+	return OptionFunc(func(q *Options) {
+		if num < 0 {
+			num = 0
+		}
+		q.eventBuffer = num
+	})
+}
+
+// WithPersistence set the file the ring saves its buffered messages to on
+// shutdown and reloads them from on creation. Only job messages carrying a
+// payload are saved, task functions cannot be encoded.
+func WithPersistence(path string) Option {
+	return OptionFunc(func(q *Options) {
+		q.persistPath = path
+	})
+}
+
+// WithScheduler set the Scheduler the ring delegates the order of its
+// buffered tasks to, FIFO by default. OverflowDropOldest drops the task the
+// scheduler would hand out next.
+func WithScheduler(s Scheduler) Option {
+	return OptionFunc(func(q *Options) {
+		q.scheduler = s
+	})
+}
+
+// WithShutdownMode set how Shutdown treats the pending work
+func WithShutdownMode(m ShutdownMode) Option {
+	return OptionFunc(func(q *Options) {
+		q.shutdownMode = m
+	})
+}
+
+// WithRetryMode set how the failed jobs are retried, RetryInProcess by default
+func WithRetryMode(m RetryMode) Option {
+	return OptionFunc(func(q *Options) {
+		q.retryMode = m
+	})
+}
+
+// WithClock set the time source used for timeouts, retry delays and
+// polling, the polls of Flush and of a draining shutdown included
+func WithClock(c Clock) Option {
+	return OptionFunc(func(q *Options) {
+		q.clock = c
+	})
+}
+
+// WithHandlerPool set how many goroutines are kept to run the jobs instead
+// of starting a new goroutine per job. Jobs still get a new goroutine when
+// all of them are busy. Zero disables the pool.
+func WithHandlerPool(num int) Option {
+	return OptionFunc(func(q *Options) {
+		q.handlerPool = num
+	})
+}
+
 // WithLogger set custom logger
 func WithLogger(l Logger) Option {
 	return OptionFunc(func(q *Options) {
@@ -52,13 +343,32 @@ func WithLogger(l Logger) Option {
 	})
 }
 
-// WithMetric set custom Metric
+// WithLogLevel set the minimum level written by the default logger,
+// it has no effect on a logger set by WithLogger
+func WithLogLevel(level LogLevel) Option {
+	return OptionFunc(func(q *Options) {
+		q.logLevel = level
+	})
+}
+
+// WithMetric set custom Metric, called by the queue as jobs are submitted
+// and handled. Each queue gets its own NewMetric by default.
 func WithMetric(m Metric) Option {
 	return OptionFunc(func(q *Options) {
 		q.metric = m
 	})
 }
 
+// WithMetricsDisabled replaces the metric of the queue with one doing
+// nothing, to save the atomic updates on every job. The counters of the
+// queue, such as SuccessTasks or BusyWorkers, then always return zero. It
+// takes precedence over WithMetric.
+func WithMetricsDisabled() Option {
+	return OptionFunc(func(q *Options) {
+		q.metricsDisabled = true
+	})
+}
+
 // WithWorker set custom worker
 func WithWorker(w core.Worker) Option {
 	return OptionFunc(func(q *Options) {
@@ -66,7 +376,8 @@ func WithWorker(w core.Worker) Option {
 	})
 }
 
-// WithFn set custom job function
+// WithFn set custom job function, run for the messages without task
+// function. Without it such messages fail with ErrMissingRunFunc.
 func WithFn(fn func(context.Context, core.TaskMessage) error) Option {
 	return OptionFunc(func(q *Options) {
 		q.fn = fn
@@ -80,15 +391,174 @@ func WithAfterFn(afterFn func()) Option {
 	})
 }
 
+// WithDefaultJobOptions set the job options applied to every submission.
+// Options passed to Queue or QueueTask take precedence over these defaults.
+func WithDefaultJobOptions(opts ...job.AllowOption) Option {
+	return OptionFunc(func(q *Options) {
+		q.jobOptions = job.MergeOptions(opts...)
+	})
+}
+
+// WithStatusCapacity set how many finished jobs keep their status
+// available to Queue.Status. Up to 64 times as many pending and running
+// jobs are tracked, the oldest are forgotten beyond that.
+func WithStatusCapacity(num int) Option {
+	return OptionFunc(func(q *Options) {
+		q.statusCapacity = num
+	})
+}
+
+// WithPanicPolicy set how panics raised by tasks are handled
+func WithPanicPolicy(p PanicPolicy) Option {
+	return OptionFunc(func(q *Options) {
+		q.panicPolicy = p
+	})
+}
+
+// WithDeadLetter set the sink receiving tasks that failed permanently,
+// together with the error that made them fail. Jobs cancelled by a shutdown
+// are forwarded too, with an error matching ErrCancelledOnShutdown.
+func WithDeadLetter(fn func(task core.TaskMessage, err error)) Option {
+	return OptionFunc(func(q *Options) {
+		q.deadLetter = fn
+	})
+}
+
+// WithDecodeErrorPolicy set what happens to messages that can't be decoded
+func WithDecodeErrorPolicy(p DecodeErrorPolicy) Option {
+	return OptionFunc(func(q *Options) {
+		q.decodeErrorPolicy = p
+	})
+}
+
+// WithPollInterval set how long an idle queue waits before asking the
+// worker for a new task again
+func WithPollInterval(d time.Duration) Option {
+	return OptionFunc(func(q *Options) {
+		if d <= 0 {
+			d = defaultPollInterval
+		}
+		q.pollInterval = d
+	})
+}
+
+// WithIdleBackoff makes an idle queue wait min before asking the worker for
+// a new task again, doubling the wait up to max while the worker stays empty,
+// instead of the flat poll interval. It starts over from min once tasks
+// arrive or the queue is woken up, e.g. by Flush.
+func WithIdleBackoff(min, max time.Duration) Option {
+	return OptionFunc(func(q *Options) {
+		q.idleBackoffMin = min
+		q.idleBackoffMax = max
+	})
+}
+
+// WithCircuitBreaker stops running jobs once threshold attempts in a row
+// failed. For the cooldown that follows, jobs fail at once with
+// ErrCircuitOpen, then a single attempt probes whether the failures are
+// over: its success closes the breaker, its failure opens it again, as
+// does a probe still running after cooldown.
+// A threshold of zero disables the breaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return OptionFunc(func(q *Options) {
+		q.breakerThreshold = threshold
+		q.breakerCooldown = cooldown
+	})
+}
+
+// WithThroughputWindow set the sliding window Queue.Throughput averages
+// the completed jobs over
+func WithThroughputWindow(d time.Duration) Option {
+	return OptionFunc(func(q *Options) {
+		if d <= 0 {
+			d = defaultThroughputWindow
+		}
+		q.throughputWindow = d
+	})
+}
+
+// WithBackpressureCallback set the function called when the worker stays
+// filled above the backpressure threshold for a whole window. It is called
+// again for every further window the pressure lasts. Workers must implement
+// core.UsageReporter and core.CapacityReporter with a non-zero capacity.
+func WithBackpressureCallback(fn func(usage, capacity int)) Option {
+	return OptionFunc(func(q *Options) {
+		q.backpressureFn = fn
+	})
+}
+
+// WithBackpressureWindow set how long the usage must stay above the
+// threshold before the backpressure callback is called
+func WithBackpressureWindow(d time.Duration) Option {
+	return OptionFunc(func(q *Options) {
+		if d <= 0 {
+			d = defaultBackpressureWindow
+		}
+		q.backpressureWindow = d
+	})
+}
+
+// WithBackpressureThreshold set the usage to capacity ratio, between 0 and 1,
+// above which the queue is considered under pressure
+func WithBackpressureThreshold(ratio float64) Option {
+	return OptionFunc(func(q *Options) {
+		if ratio <= 0 || ratio > 1 {
+			ratio = defaultBackpressureThreshold
+		}
+		q.backpressureThreshold = ratio
+	})
+}
+
 // Options for custom args in Queue
 type Options struct {
 	workerCount int64
 	logger      Logger
 	queueSize   int
+	maxBytes    int
 	worker      core.Worker
 	fn          func(context.Context, core.TaskMessage) error
 	afterFn     func()
 	metric      Metric
+	jobOptions  job.AllowOption
+
+	statusCapacity int
+	panicPolicy    PanicPolicy
+	deadLetter     func(core.TaskMessage, error)
+	pollInterval   time.Duration
+	overflowPolicy OverflowPolicy
+	eventBuffer    int
+	persistPath    string
+	scheduler      Scheduler
+	logLevel       LogLevel
+	maxInFlight    int
+	shutdownMode   ShutdownMode
+	retryMode      RetryMode
+	clock          Clock
+	handlerPool    int
+
+	backpressureFn        func(usage, capacity int)
+	backpressureWindow    time.Duration
+	backpressureThreshold float64
+	decodeErrorPolicy     DecodeErrorPolicy
+	throughputWindow      time.Duration
+	metricsDisabled       bool
+	breakerThreshold      int
+	breakerCooldown       time.Duration
+	maxPayloadSize        int
+	leaseHeartbeat        time.Duration
+	requeueDelay          time.Duration
+	maxRequeues           int
+	slowTaskFn            func(core.TaskMessage, time.Duration)
+	ackBatchSize          int
+	ackFlushInterval      time.Duration
+	classConcurrency      map[string]int
+	resultSummarizer      func(core.QueuedMessage, error) string
+	cpuMultiplier         float64
+	manualDispatch        bool
+	inlineExecution       bool
+	dynamicTimeout        func(core.QueuedMessage) time.Duration
+	idleBackoffMin        time.Duration
+	idleBackoffMax        time.Duration
 }
 
 // NewOptions initialize the default value for the options
@@ -96,10 +566,20 @@ func NewOptions(opts ...Option) *Options {
 	o := &Options{
 		workerCount: defaultWorkerCount,
 		queueSize:   defaultCapacity,
-		logger:      defaultNewLogger,
 		worker:      nil,
 		fn:          defaultFn,
-		metric:      defaultMetric,
+
+		statusCapacity: defaultStatusCapacity,
+		pollInterval:   defaultPollInterval,
+		eventBuffer:    defaultEventBuffer,
+		logLevel:       InfoLevel,
+		clock:          defaultClock,
+
+		throughputWindow:      defaultThroughputWindow,
+		ackBatchSize:          defaultAckBatchSize,
+		ackFlushInterval:      defaultAckFlushInterval,
+		backpressureWindow:    defaultBackpressureWindow,
+		backpressureThreshold: defaultBackpressureThreshold,
 	}
 
 	// Loop through each option
@@ -108,5 +588,60 @@ func NewOptions(opts ...Option) *Options {
 		opt.apply(o)
 	}
 
+	if o.logger == nil {
+		o.logger = NewLevelLogger(o.logLevel)
+	}
+
 	return o
 }
+
+// cpuLimit returns the cap set by WithCPUScaling, zero if there is none.
+func (o *Options) cpuLimit() int64 {
+	if o.cpuMultiplier == 0 {
+		return 0
+	}
+	n := int64(o.cpuMultiplier * float64(numCPU()))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// validate reports the first option that can't be used, as an error
+// wrapping ErrInvalidOption. Options with a sensible default, like the
+// worker count or the logger, are substituted when they are set instead.
+func (o *Options) validate() error {
+	switch {
+	case o.queueSize < 0:
+		return fmt.Errorf("%w: negative queue size %d", ErrInvalidOption, o.queueSize)
+	case o.maxBytes < 0:
+		return fmt.Errorf("%w: negative max bytes %d", ErrInvalidOption, o.maxBytes)
+	case o.maxPayloadSize < 0:
+		return fmt.Errorf("%w: negative max payload size %d", ErrInvalidOption, o.maxPayloadSize)
+	case o.requeueDelay < 0 || o.maxRequeues < 0:
+		return fmt.Errorf("%w: negative requeue delay %s or max requeues %d",
+			ErrInvalidOption, o.requeueDelay, o.maxRequeues)
+	case o.leaseHeartbeat < 0:
+		return fmt.Errorf("%w: negative lease heartbeat %s", ErrInvalidOption, o.leaseHeartbeat)
+	case o.maxInFlight < 0:
+		return fmt.Errorf("%w: negative max in flight %d", ErrInvalidOption, o.maxInFlight)
+	case o.handlerPool < 0:
+		return fmt.Errorf("%w: negative handler pool %d", ErrInvalidOption, o.handlerPool)
+	case o.statusCapacity < 0:
+		return fmt.Errorf("%w: negative status capacity %d", ErrInvalidOption, o.statusCapacity)
+	case o.breakerThreshold < 0 || o.breakerCooldown < 0:
+		return fmt.Errorf("%w: negative circuit breaker threshold %d or cooldown %s",
+			ErrInvalidOption, o.breakerThreshold, o.breakerCooldown)
+	case o.idleBackoffMin < 0 || o.idleBackoffMax < o.idleBackoffMin:
+		return fmt.Errorf("%w: idle backoff from %s to %s", ErrInvalidOption, o.idleBackoffMin, o.idleBackoffMax)
+	case o.overflowPolicy != OverflowReject && o.queueSize == 0 && o.maxBytes == 0:
+		// without a bound the ring never overflows
+		return fmt.Errorf("%w: overflow policy requires a queue size or max bytes", ErrInvalidOption)
+	}
+	for class, n := range o.classConcurrency {
+		if n <= 0 {
+			return fmt.Errorf("%w: concurrency %d of class %q is not positive", ErrInvalidOption, n, class)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewQueueInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"negative queue size", WithQueueSize(-1)},
+		{"negative max bytes", WithMaxBytes(-1)},
+		{"negative max payload size", WithMaxPayloadSize(-1)},
+		{"negative max in flight", WithMaxInFlight(-1)},
+		{"negative handler pool", WithHandlerPool(-1)},
+		{"negative status capacity", WithStatusCapacity(-1)},
+		{"negative breaker threshold", WithCircuitBreaker(-1, time.Second)},
+		{"negative breaker cooldown", WithCircuitBreaker(3, -time.Second)},
+		{"unbounded overflow policy", WithOverflowPolicy(OverflowDropOldest)},
+		{"zero class concurrency", WithClassConcurrency(map[string]int{"slow": 0})},
+		{"negative idle backoff", WithIdleBackoff(-time.Second, time.Second)},
+		{"idle backoff max below min", WithIdleBackoff(time.Second, time.Millisecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewQueue(WithWorker(NewRing()), tt.opt)
+			assert.ErrorIs(t, err, ErrInvalidOption)
+			assert.Nil(t, q)
+		})
+	}
+}
+
+func TestNewQueueOptionDefaults(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(-2),
+		WithLogger(nil),
+		WithPollInterval(-time.Second),
+		WithEventBuffer(-1),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultWorkerCount, q.workerCount)
+	assert.NotNil(t, q.logger)
+	assert.Equal(t, defaultPollInterval, q.pollInterval)
+	assert.Equal(t, 0, cap(q.events))
+
+	// a bounded ring can drop tasks
+	_, err = NewQueue(
+		WithWorker(NewRing()),
+		WithQueueSize(2),
+		WithOverflowPolicy(OverflowDropNewest),
+	)
+	assert.NoError(t, err)
+}
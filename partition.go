@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"sync"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+)
+
+// partitions keeps the jobs waiting for the running job of their partition.
+type partitions struct {
+	sync.Mutex
+	pending map[string][]core.TaskMessage // active partition key -> jobs queued behind the running one
+}
+
+func newPartitions() *partitions {
+	return &partitions{
+		pending: make(map[string][]core.TaskMessage),
+	}
+}
+
+// partitionKey returns the partition key of the task, empty if it has none.
+func partitionKey(task core.TaskMessage) string {
+	if m, ok := task.(*job.Message); ok {
+		return m.PartitionKey
+	}
+	return ""
+}
+
+// enqueue queues the task behind the running job of its partition and
+// reports whether it did. It returns false when the task has no partition
+// or its partition is idle, which the task then activates.
+func (p *partitions) enqueue(task core.TaskMessage) bool {
+	key := partitionKey(task)
+	if key == "" {
+		return false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	pending, ok := p.pending[key]
+	if !ok {
+		p.pending[key] = nil
+		return false
+	}
+	p.pending[key] = append(pending, task)
+	return true
+}
+
+// next returns the next job of the partition, or nil once it has none left
+// and becomes idle.
+func (p *partitions) next(key string) core.TaskMessage {
+	if key == "" {
+		return nil
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	pending := p.pending[key]
+	if len(pending) == 0 {
+		delete(p.pending, key)
+		return nil
+	}
+	task := pending[0]
+	pending[0] = nil
+	p.pending[key] = pending[1:]
+	return task
+}
+
+// dispatch runs the task, then the jobs queued behind it in its partition
+// one after the other on the same goroutine and worker.
+func (q *Queue) dispatch(task core.TaskMessage) {
+	for task != nil {
+		task = q.work(task)
+	}
+}
@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionKeyOrder(t *testing.T) {
+	keys := []string{"account-1", "account-2", "account-3"}
+	total := 20
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	var running, peak int32
+
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(8),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		for _, key := range keys {
+			i, key := i, key
+			assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				mu.Lock()
+				got[key] = append(got[key], i)
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				return nil
+			}, job.WithPartitionKey(key)))
+		}
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == uint64(total*len(keys))
+	}, 5*time.Second, 5*time.Millisecond)
+	q.Release()
+
+	want := make([]int, total)
+	for i := range want {
+		want[i] = i
+	}
+	for _, key := range keys {
+		assert.Equal(t, want, got[key], key)
+	}
+	// the partitions ran in parallel, but never more than one job each
+	assert.Greater(t, atomic.LoadInt32(&peak), int32(1))
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(len(keys)))
+}
+
+func TestPartitionKeyFailureKeepsOrder(t *testing.T) {
+	var got []string
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(4),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		i := i
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			got = append(got, fmt.Sprint(i))
+			if i%2 == 0 {
+				return fmt.Errorf("job %d failed", i)
+			}
+			return nil
+		}, job.WithPartitionKey("stream")))
+	}
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, []string{"0", "1", "2", "3", "4"}, got)
+	assert.Equal(t, uint64(3), q.FailureTasks())
+	assert.Equal(t, int64(0), q.BusyWorkers())
+}
+
+func TestPartitionKeyDoesNotStarveOthers(t *testing.T) {
+	release := make(chan struct{})
+	other := make(chan struct{})
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			<-release
+			return nil
+		}, job.WithPartitionKey("hot")))
+	}
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		close(other)
+		return nil
+	}, job.WithPartitionKey("cold")))
+	assert.NoError(t, q.Start())
+
+	// the jobs waiting behind the hot partition hold no worker
+	select {
+	case <-other:
+	case <-time.After(time.Second):
+		t.Fatal("the cold partition is starved")
+	}
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(1), q.BusyWorkers())
+	assert.Equal(t, 0.5, q.Saturation())
+
+	close(release)
+	q.Release()
+	assert.Equal(t, uint64(6), q.SuccessTasks())
+	assert.Equal(t, int64(0), q.BusyWorkers())
+}
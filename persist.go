@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+)
+
+// persistable reports whether task can be saved to disk, task functions
+// and streamed payloads can't be encoded.
+func persistable(task core.TaskMessage) (*job.Message, bool) {
+	m, ok := task.(*job.Message)
+	if !ok || m.Task != nil || m.Stream != nil {
+		return nil, false
+	}
+	return m, true
+}
+
+// persist moves the buffered payload messages out of the ring and writes
+// them to the persistence file, in the order the scheduler gets them back
+// in. Other tasks stay queued, as do all of them if the file can't be
+// written.
+func (s *Ring) persist() error {
+	s.Lock()
+	defer s.Unlock()
+
+	// encode a snapshot, the messages only leave the ring once it is saved
+	var buf bytes.Buffer
+	s.scheduler.Filter(func(task core.TaskMessage) bool {
+		if m, ok := persistable(task); ok {
+			buf.Write(job.Encode(m))
+			buf.WriteByte('\n')
+		}
+		return true
+	})
+	if buf.Len() == 0 {
+		return nil
+	}
+	if err := os.WriteFile(s.persistPath, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+
+	s.scheduler.Filter(func(task core.TaskMessage) bool {
+		if _, ok := persistable(task); !ok {
+			return true
+		}
+		s.count--
+		if s.maxBytes > 0 {
+			s.bytes -= len(task.Payload())
+		}
+		return false
+	})
+	return nil
+}
+
+// restore queues the messages saved by persist and removes the file. Nothing
+// is queued unless the whole file is decoded and removed, so that a message
+// is never restored twice. Restored messages are not subject to the capacity
+// or byte limits.
+func (s *Ring) restore() error {
+	f, err := os.Open(s.persistPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var messages []*job.Message
+	dec := json.NewDecoder(f)
+	for {
+		m := &job.Message{}
+		if err := dec.Decode(m); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+
+	if err := os.Remove(s.persistPath); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	for _, m := range messages {
+		size := 0
+		if s.maxBytes > 0 {
+			size = len(m.Payload())
+		}
+		s.push(m, size)
+	}
+	return nil
+}
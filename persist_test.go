@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	w := NewRing(WithPersistence(path))
+	for _, body := range []string{"foo", "bar", "baz"} {
+		m := job.NewMessage(&mockMessage{message: body})
+		assert.NoError(t, w.Queue(&m))
+	}
+	assert.NoError(t, w.Shutdown())
+	_, err := os.Stat(path)
+	assert.NoError(t, err)
+
+	w = NewRing(WithPersistence(path))
+	for _, body := range []string{"foo", "bar", "baz"} {
+		task, err := w.Request()
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(task.Payload()))
+	}
+	_, err = w.Request()
+	assert.Equal(t, ErrNoTaskInQueue, err)
+
+	// the file is consumed by the reload
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, w.Shutdown())
+}
+
+func TestPersistenceKeepsTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	w := NewRing(WithPersistence(path))
+	m := job.NewMessage(&mockMessage{message: "foo"})
+	assert.NoError(t, w.Queue(&m))
+	task := job.NewTask(func(context.Context) error { return nil })
+	assert.NoError(t, w.Queue(&task))
+
+	// task functions can't be encoded and stay in the ring
+	assert.NoError(t, w.persist())
+	got, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, &task, got)
+	_, err = w.Request()
+	assert.Equal(t, ErrNoTaskInQueue, err)
+
+	w = NewRing(WithPersistence(path))
+	got, err = w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(got.Payload()))
+}
+
+func TestPersistenceWriteError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "queue.db")
+
+	w := NewRing(WithPersistence(path), WithMaxBytes(100))
+	for _, body := range []string{"foo", "bar"} {
+		m := job.NewMessage(&mockMessage{message: body})
+		assert.NoError(t, w.Queue(&m))
+	}
+
+	// nothing is lost when the file can't be written
+	assert.Error(t, w.persist())
+	assert.Equal(t, 2, w.Usage())
+	for _, body := range []string{"foo", "bar"} {
+		task, err := w.Request()
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(task.Payload()))
+	}
+	_, err := w.Request()
+	assert.Equal(t, ErrNoTaskInQueue, err)
+}
+
+func TestPersistenceRestoreError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	m := job.NewMessage(&mockMessage{message: "foo"})
+	data := append(job.Encode(&m), []byte("\n{not json\n")...)
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+
+	// a partly decoded file restores nothing and stays in place
+	w := NewRing(WithPersistence(path), WithLogger(NewEmptyLogger()))
+	assert.Equal(t, 0, w.Usage())
+	_, err := os.Stat(path)
+	assert.NoError(t, err)
+}
@@ -16,7 +16,9 @@ func NewPool(size int64, opts ...Option) *Queue {
 		panic(err)
 	}
 
-	q.Start()
+	if err := q.Start(); err != nil {
+		panic(err)
+	}
 
 	return q
 }
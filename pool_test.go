@@ -31,7 +31,7 @@ func TestNewPoolWithQueueTask(t *testing.T) {
 
 func TestPoolNumber(t *testing.T) {
 	p := NewPool(0)
-	p.Start()
+	assert.NoError(t, p.Start())
 	// shutdown all, and now running worker is 0
 	p.Release()
 	assert.Equal(t, int64(0), p.BusyWorkers())
@@ -2,7 +2,10 @@ package queue
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,34 +23,159 @@ type (
 	// A Queue is a message queue.
 	Queue struct {
 		sync.Mutex
-		metric       *metric
+		metric       *queueMetric
+		busy         int64 // busy counts the running jobs, whatever the metric
 		logger       Logger
 		workerCount  int64
+		cpuLimit     int64 // caps workerCount when set by WithCPUScaling
 		routineGroup *routineGroup
 		quit         chan struct{}
 		ready        chan struct{}
+		wake         chan struct{} // cuts the poll interval short
+		manual       bool          // dispatched by Tick instead of the loop
+		retryMode    RetryMode
+		inline       bool          // runs jobs without timeout on the worker goroutine
+		submit       sync.RWMutex  // held for reading while a job is handed to the worker
+		started      chan struct{} // closed once the dispatcher loop runs
+		startedOnce  sync.Once
 		worker       core.Worker
 		stopOnce     sync.Once
 		stopFlag     int32
+		ran          int32 // set once Start got past BeforeRun, see AfterRun
+		unprocessed  int64  // tasks left over by the shutdown
+		requested    uint64 // tasks handed out by the worker
 		afterFn      func()
+		slots        []bool
+		limits       *limiter // concurrency keys and class limits
+		waiters      sync.Map // *job.Message -> func(error)
+		callers      sync.Map // *job.Message -> context.Context
+		running      sync.Map // job ID -> *context.CancelFunc
+		present      sync.Map // job ID -> struct{}, see QueueIfAbsent
+		jobOptions   job.AllowOption
+		status       *statusTracker
+		panicPolicy  PanicPolicy
+		deadLetter   func(core.TaskMessage, error)
+		pollInterval time.Duration
+		idleMin      time.Duration // first wait of the idle backoff, zero polls at pollInterval
+		idleMax      time.Duration
+		events       chan Event
+		inFlight     chan struct{}
+		shutdownMode ShutdownMode
+		clock        Clock
+		handlers     *goroutinePool
+		handlerPool  int
+		requestCtx   context.Context // requestCtx is cancelled on shutdown to stop a blocking request
+		stopRequest  context.CancelFunc
+		interrupt    context.CancelFunc // cuts the blocking request short, see ResumeTopic
+		fetching     int32              // set while a requested task is not counted as busy yet
+		backpressure *backpressure
+		acker        *acker
+		decodePolicy DecodeErrorPolicy
+		topics       *topicGate
+		throughput   *throughput
+		partitions   *partitions
+		breaker      *breaker
+		maxPayload   int
+		leaseEvery   time.Duration
+		requeueDelay time.Duration
+		maxRequeues  int
+		slowTask     func(core.TaskMessage, time.Duration)
+		timeoutFn    func(core.QueuedMessage) time.Duration // computes the job timeout, see WithDynamicTimeout
+		summarize    func(core.QueuedMessage, error) string
 	}
 )
 
 // ErrMissingWorker missing define worker
 var ErrMissingWorker = errors.New("missing worker module")
 
-// NewQueue returns a Queue.
+// NewQueue returns a Queue. It returns an error wrapping ErrInvalidOption
+// when an option can't be used.
 func NewQueue(opts ...Option) (*Queue, error) {
 	o := NewOptions(opts...)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
 	q := &Queue{
 		routineGroup: newRoutineGroup(),
 		quit:         make(chan struct{}),
 		ready:        make(chan struct{}, 1),
+		wake:         make(chan struct{}, 1),
+		manual:       o.manualDispatch,
+		inline:       o.inlineExecution,
+		retryMode:    o.retryMode,
+		started:      make(chan struct{}),
 		workerCount:  o.workerCount,
+		cpuLimit:     o.cpuLimit(),
 		logger:       o.logger,
 		worker:       o.worker,
-		metric:       &metric{},
 		afterFn:      o.afterFn,
+		limits:       newLimiter(o.classConcurrency),
+		jobOptions:   o.jobOptions,
+		status:       newStatusTracker(o.statusCapacity),
+		panicPolicy:  o.panicPolicy,
+		deadLetter:   o.deadLetter,
+		pollInterval: o.pollInterval,
+		idleMin:      o.idleBackoffMin,
+		idleMax:      o.idleBackoffMax,
+		events:       make(chan Event, o.eventBuffer),
+		shutdownMode: o.shutdownMode,
+		clock:        o.clock,
+		handlerPool:  o.handlerPool,
+		decodePolicy: o.decodeErrorPolicy,
+		topics:       newTopicGate(),
+		throughput:   newThroughput(o.clock, o.throughputWindow),
+		partitions:   newPartitions(),
+		maxPayload:   o.maxPayloadSize,
+		leaseEvery:   o.leaseHeartbeat,
+		requeueDelay: o.requeueDelay,
+		maxRequeues:  o.maxRequeues,
+		slowTask:     o.slowTaskFn,
+		timeoutFn:    o.dynamicTimeout,
+		summarize:    o.resultSummarizer,
+	}
+	if q.handlerPool > 0 {
+		q.handlers = newGoroutinePool()
+	}
+	q.requestCtx, q.stopRequest = context.WithCancel(context.Background())
+
+	m := o.metric
+	if m == nil {
+		m = NewMetric()
+	}
+	if o.metricsDisabled {
+		m = noopMetric{}
+	}
+	q.metric = newQueueMetric(m)
+
+	if o.breakerThreshold > 0 {
+		q.breaker = newBreaker(o.clock, o.breakerThreshold, o.breakerCooldown)
+	}
+
+	if o.backpressureFn != nil {
+		q.backpressure = &backpressure{
+			fn:        o.backpressureFn,
+			window:    o.backpressureWindow,
+			threshold: o.backpressureThreshold,
+			clock:     o.clock,
+		}
+	}
+
+	if w, ok := o.worker.(core.BatchAcker); ok {
+		q.acker = &acker{
+			worker:   w,
+			size:     o.ackBatchSize,
+			interval: o.ackFlushInterval,
+			clock:    o.clock,
+			logger:   o.logger,
+		}
+	}
+
+	if o.maxInFlight > 0 {
+		q.inFlight = make(chan struct{}, o.maxInFlight)
+	}
+
+	if d, ok := o.worker.(core.DropNotifier); ok {
+		d.OnDrop(q.dropped)
 	}
 
 	if q.worker == nil {
@@ -57,35 +185,291 @@ func NewQueue(opts ...Option) (*Queue, error) {
 	return q, nil
 }
 
-// Start to enable all worker
-func (q *Queue) Start() {
-	q.Lock()
-	count := q.workerCount
-	q.Unlock()
-	if count == 0 {
-		return
+// Start to enable all worker. When the worker implements core.BeforeRunner,
+// BeforeRun is called first and its error aborts the start.
+func (q *Queue) Start() error {
+	if r, ok := q.worker.(core.BeforeRunner); ok {
+		if err := r.BeforeRun(); err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt32(&q.ran, 1)
+
+	if q.handlers != nil {
+		q.handlers.start(q.handlerPool, q.quit)
+	}
+
+	if q.backpressure != nil {
+		q.routineGroup.Run(func() {
+			q.backpressure.run(q.worker, q.quit)
+		})
+	}
+
+	if q.acker != nil {
+		q.routineGroup.Run(func() {
+			q.acker.run(q.quit, func() bool {
+				return atomic.LoadInt64(&q.busy) == 0
+			})
+		})
 	}
+
+	// the caller drives the dispatch with Tick
+	if q.manual {
+		q.startedOnce.Do(func() {
+			close(q.started)
+		})
+		return nil
+	}
+
+	// the loop also runs with zero workers so that UpdateWorkerCount
+	// can resume processing later
 	q.routineGroup.Run(func() {
 		q.start()
 	})
+
+	return nil
 }
 
-// Shutdown stops all queues.
+// StartAndWait starts the queue like Start, then blocks until the
+// dispatcher loop and the handler pool are running, so that the queue is
+// ready to pick up jobs when it returns. It returns ctx.Err() when ctx is
+// done first, the queue is started nonetheless and must be released.
+func (q *Queue) StartAndWait(ctx context.Context) error {
+	if err := q.Start(); err != nil {
+		return err
+	}
+
+	ready := make(chan struct{})
+	go func() {
+		if q.handlers != nil {
+			q.handlers.wait()
+		}
+		<-q.started
+		close(ready)
+	}()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ProcessN requests up to n tasks from the worker and handles them one by
+// one on the calling goroutine, without starting the queue. It returns the
+// number of tasks handled, whether they failed or not, and stops early when
+// the worker has no task left. It returns ctx.Err() when ctx is done before
+// n tasks are handled. Don't use it on a started queue.
+func (q *Queue) ProcessN(ctx context.Context, n int) (int, error) {
+	processed, skipped := 0, 0
+	for processed < n {
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+		if atomic.LoadInt32(&q.stopFlag) == 1 {
+			return processed, ErrQueueShutdown
+		}
+
+		task, err := q.requestOne()
+		if errors.Is(err, ErrNoTaskInQueue) {
+			return processed, nil
+		}
+		if err != nil {
+			return processed, err
+		}
+		if task == nil {
+			return processed, nil
+		}
+		if held, handedBack := q.hold(task); held {
+			// stop once every buffered job belongs to a paused topic
+			if handedBack {
+				skipped++
+			}
+			if l := q.Len(); handedBack && (l < 0 || skipped >= l) {
+				return processed, nil
+			}
+			continue
+		}
+		skipped = 0
+
+		if err := q.limits.wait(ctx, task); err != nil {
+			return processed, err
+		}
+		atomic.AddInt64(&q.busy, 1)
+		q.metric.IncBusyWorker()
+		q.work(task)
+		processed++
+	}
+	return processed, nil
+}
+
+// Dequeue blocks until the worker hands out the next task and returns it
+// instead of running it, turning the queue into a pull-based source for the
+// caller's own processing loop. The task isn't tracked any further: no
+// status, metric, retry or timeout applies to it, and workers implementing
+// core.Finisher get it settled as it is handed out. It returns ctx.Err() when
+// ctx is done first, and ErrQueueShutdown once the queue is shut down and
+// the worker has no task left. Don't use it on a started queue.
+func (q *Queue) Dequeue(ctx context.Context) (core.QueuedMessage, error) {
+	cw, blocking := q.worker.(core.ContextRequester)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		stopped := atomic.LoadInt32(&q.stopFlag) == 1
+
+		var task core.TaskMessage
+		var err error
+		if blocking && !stopped {
+			// stop waiting on shutdown too
+			rctx, cancel := context.WithCancel(ctx)
+			stop := context.AfterFunc(q.requestCtx, cancel)
+			task, err = cw.RequestWithContext(rctx)
+			stop()
+			cancel()
+		} else {
+			task, err = q.worker.Request()
+		}
+		if task != nil {
+			atomic.AddUint64(&q.requested, 1)
+			if err != nil {
+				q.logger.Errorf("request returned a task with error: %s", err.Error())
+			}
+			if id := jobID(task); id != "" {
+				q.status.remove(id)
+			}
+			q.finish(task, nil)
+			return task, nil
+		}
+		if stopped && !errors.Is(err, ErrNoTaskInQueue) {
+			return nil, ErrQueueShutdown
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.requestCtx.Done(): // shut down, ask the worker again
+		case <-q.clock.After(q.pollInterval):
+		case <-q.wake:
+		}
+	}
+}
+
+// Shutdown stops all queues. Errors of the worker are logged, use
+// ShutdownE to get them instead.
 func (q *Queue) Shutdown() {
+	if _, err := q.ShutdownE(); err != nil {
+		q.logger.Error(err)
+	}
+}
+
+// ShutdownE stops all queues like Shutdown. It reports whether this call
+// shut the queue down, later calls are no-ops returning false, together
+// with the errors of the worker's Shutdown and AfterRun, joined.
+func (q *Queue) ShutdownE() (bool, error) {
 	if !atomic.CompareAndSwapInt32(&q.stopFlag, 0, 1) {
-		return
+		return false, nil
 	}
+	// let the submissions in progress reach the worker before it is
+	// shut down, the later ones see the stop flag
+	q.submit.Lock()
+	q.submit.Unlock() //nolint:staticcheck
 
+	var errs []error
 	q.stopOnce.Do(func() {
-		if q.metric.BusyWorkers() > 0 {
-			q.logger.Infof("shutdown all tasks: %d workers", q.metric.BusyWorkers())
+		if busy := atomic.LoadInt64(&q.busy); busy > 0 {
+			q.logger.Infof("shutdown all tasks: %d workers", busy)
 		}
 
+		// poll the worker at once, it may hold jobs of paused topics
+		// that have to be requested before it is drained or closed
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+
+		if q.shutdownMode == ShutdownDrain {
+			q.drain()
+		}
+
+		requested := atomic.LoadUint64(&q.requested)
+		before := q.Len()
 		if err := q.worker.Shutdown(); err != nil {
-			q.logger.Error(err)
+			errs = append(errs, err)
+		}
+		// the tasks the worker set aside while shutting down, instead of
+		// handing them out, are left over too
+		unprocessed := q.Len()
+		if before >= 0 {
+			if n := before - int(atomic.LoadUint64(&q.requested)-requested); n > unprocessed {
+				unprocessed = n
+			}
+		}
+		if unprocessed < 0 {
+			unprocessed = 0
+		}
+		unprocessed += q.dropHeld()
+		atomic.StoreInt64(&q.unprocessed, int64(unprocessed))
+		if unprocessed > 0 {
+			q.logger.Infof("shutdown with %d unprocessed tasks", unprocessed)
+		}
+		// clean up only after a successful start
+		if r, ok := q.worker.(core.AfterRunner); ok && atomic.LoadInt32(&q.ran) == 1 {
+			if err := r.AfterRun(); err != nil {
+				errs = append(errs, err)
+			}
 		}
 		close(q.quit)
+		q.stopRequest()
 	})
+	return true, errors.Join(errs...)
+}
+
+// Flush wakes up the queue to request the buffered tasks at once instead
+// of after the poll interval, and blocks until the worker holds no task or
+// ctx is done, in which case it returns ctx.Err(). Unlike a draining
+// Shutdown it keeps the queue running and doesn't wait for the jobs to
+// finish. Workers that can't report their length, see Queue.Len, are only
+// woken up.
+func (q *Queue) Flush(ctx context.Context) error {
+	for {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+		if q.Len() <= 0 {
+			return nil
+		}
+
+		select {
+		case <-q.clock.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// drain blocks until the worker has no buffered task, as far as it can
+// tell, and no job is running.
+func (q *Queue) drain() {
+	// stop blocking requests, a request waiting for work would otherwise
+	// look like a task in transit forever
+	q.stopRequest()
+
+	for !q.drained() {
+		<-q.clock.After(10 * time.Millisecond)
+	}
+}
+
+// drained reports whether all the work has been handled. The checks follow
+// a task through the queue, buffered, then requested, then busy, so that a
+// task moving between two of them can't be missed.
+func (q *Queue) drained() bool {
+	if q.Len() > 0 {
+		return false
+	}
+	return atomic.LoadInt32(&q.fetching) == 0 && atomic.LoadInt64(&q.busy) == 0
 }
 
 // Release for graceful shutdown.
@@ -104,6 +488,26 @@ func (q *Queue) SuccessTasks() uint64 {
 	return q.metric.SuccessTasks()
 }
 
+// FailuresByType returns the numbers of failure tasks by failure type,
+// FailureTimeout, FailurePanic, FailureTask or FailureDecode.
+func (q *Queue) FailuresByType() map[string]uint64 {
+	return q.metric.FailuresByType()
+}
+
+// failureType returns the failure type of a job that failed with err.
+func failureType(err error, panicked bool) string {
+	switch {
+	case panicked:
+		return FailurePanic
+	case errors.Is(err, ErrDecodeMessage):
+		return FailureDecode
+	case errors.Is(err, context.DeadlineExceeded):
+		return FailureTimeout
+	default:
+		return FailureTask
+	}
+}
+
 // BusyWorkers returns the numbers of failure tasks.
 func (q *Queue) FailureTasks() uint64 {
 	return q.metric.FailureTasks()
@@ -119,159 +523,912 @@ func (q *Queue) CompletedTasks() uint64 {
 	return q.metric.CompletedTasks()
 }
 
+// Throughput returns the number of jobs completed per second, averaged over
+// the window set by WithThroughputWindow.
+func (q *Queue) Throughput() float64 {
+	return q.throughput.rate()
+}
+
+// CircuitState returns the state of the circuit breaker, always
+// CircuitClosed without WithCircuitBreaker.
+func (q *Queue) CircuitState() CircuitState {
+	return q.breaker.current()
+}
+
+// AverageWaitTime returns the average time the started jobs waited between
+// their submission and the start of their handling.
+func (q *Queue) AverageWaitTime() time.Duration {
+	return q.metric.AverageWaitTime()
+}
+
+// Status returns the status of the job submitted with the given ID.
+// Finished jobs are only remembered for a bounded number of
+// entries, see WithStatusCapacity.
+func (q *Queue) Status(id string) (JobStatus, bool) {
+	return q.status.get(id)
+}
+
+// RetriedTasks returns the numbers of retry attempts.
+func (q *Queue) RetriedTasks() uint64 {
+	return q.metric.RetriedTasks()
+}
+
+// DeadLetteredTasks returns the numbers of tasks forwarded to the dead-letter sink.
+func (q *Queue) DeadLetteredTasks() uint64 {
+	return q.metric.DeadLetteredTasks()
+}
+
+// DroppedTasks returns the numbers of undecodable messages discarded under
+// the DecodeDrop policy and of the jobs the worker discarded after accepting
+// them, see core.DropNotifier.
+func (q *Queue) DroppedTasks() uint64 {
+	return q.metric.DroppedTasks()
+}
+
+// ExpiredTasks returns the numbers of jobs skipped because they waited
+// longer than their max age, see job.WithMaxAge.
+func (q *Queue) ExpiredTasks() uint64 {
+	return q.metric.ExpiredTasks()
+}
+
+// Len returns the number of tasks waiting in the worker. It returns -1 when
+// the worker doesn't implement core.UsageReporter or can't tell cheaply.
+func (q *Queue) Len() int {
+	if u, ok := q.worker.(core.UsageReporter); ok {
+		return u.Usage()
+	}
+	return -1
+}
+
+// Unprocessed returns the number of tasks left unprocessed by the shutdown:
+// the ones the worker still held once it was shut down, or set aside while
+// shutting down instead of handing them out, as far as it can tell, see Len,
+// and the held jobs of paused topics. It is zero until the queue is shut
+// down. A Ring hands out its buffered tasks before its shutdown returns,
+// unless it persists them, in which case they are counted.
+func (q *Queue) Unprocessed() int {
+	return int(atomic.LoadInt64(&q.unprocessed))
+}
+
+// Worker returns the worker set with WithWorker, e.g. to type-assert it to
+// its concrete type for operations core.Worker does not cover. Queueing to
+// or requesting from it directly bypasses the queue: such jobs are not
+// counted, tracked or limited, and may be run by the queue without it
+// knowing where they came from. Don't shut it down, use Shutdown instead.
+func (q *Queue) Worker() core.Worker {
+	return q.worker
+}
+
+// IsEmpty reports whether the worker holds no task. An unknown length is
+// not considered empty.
+func (q *Queue) IsEmpty() bool {
+	return q.Len() == 0
+}
+
 // Wait all process
 func (q *Queue) Wait() {
 	q.routineGroup.Wait()
 }
 
-// Queue to queue single job with binary
+// WaitContext waits for all processes like Wait, but returns ctx.Err()
+// when ctx is done first.
+func (q *Queue) WaitContext(ctx context.Context) error {
+	select {
+	case <-q.routineGroup.done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Queue to queue single job with binary. When the worker refuses the job,
+// the error is a *QueueError telling why.
 func (q *Queue) Queue(message core.QueuedMessage, opts ...job.AllowOption) error {
-	data := job.NewMessage(message, opts...)
+	if message == nil {
+		return ErrNilMessage
+	}
+	data := job.NewMessage(message, q.mergeJobOptions(opts...))
 
 	return q.queue(&data)
 }
 
+// QueueIfAbsent queues a single job like Queue unless a job with the same
+// ID is pending or running, and reports whether it queued it. The ID is set
+// with job.AllowOption.ID, ErrMissingID is returned without one. The ID is
+// present from the submission until the job finishes, whatever its outcome,
+// retries included, or until the worker drops it, see ErrTaskDropped. Jobs
+// queued otherwise under the same ID free it when they finish too.
+func (q *Queue) QueueIfAbsent(message core.QueuedMessage, opts ...job.AllowOption) (bool, error) {
+	if message == nil {
+		return false, ErrNilMessage
+	}
+	data := job.NewMessage(message, q.mergeJobOptions(opts...))
+	if data.ID == "" {
+		return false, ErrMissingID
+	}
+
+	if _, loaded := q.present.LoadOrStore(data.ID, struct{}{}); loaded {
+		return false, nil
+	}
+	if err := q.queue(&data); err != nil {
+		q.present.Delete(data.ID)
+		return false, err
+	}
+	return true, nil
+}
+
+// QueueRaw queues a job message already encoded by job.Encode, e.g. one
+// read back from a dead-letter sink, as is instead of wrapping it into a new
+// message. It returns an error wrapping ErrDecodeMessage if encoded is not
+// a job message.
+func (q *Queue) QueueRaw(encoded []byte) error {
+	data := &job.Message{}
+	if err := json.Unmarshal(encoded, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecodeMessage, err)
+	}
+
+	return q.queue(data)
+}
+
 // QueueTask to queue single task
 func (q *Queue) QueueTask(task job.TaskFunc, opts ...job.AllowOption) error {
-	data := job.NewTask(task, opts...)
+	if task == nil {
+		return ErrNilTask
+	}
+	data := job.NewTask(task, q.mergeJobOptions(opts...))
 	return q.queue(&data)
 }
 
+// QueueTaskAndWait queues a single task and blocks until a worker has
+// handled it, returning the task error. It returns ctx.Err() when ctx is
+// done before the task finishes and ErrQueueShutdown when the queue is closed.
+// Cancelling ctx also cancels the context the task runs with, or skips the
+// task when it has not started yet. Only tasks handled by this process see
+// the cancellation, a remote worker can't honor it.
+func (q *Queue) QueueTaskAndWait(ctx context.Context, task job.TaskFunc, opts ...job.AllowOption) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	data := job.NewTask(task, q.mergeJobOptions(opts...))
+	done := make(chan error, 1)
+	q.waiters.Store(&data, func(err error) {
+		done <- err
+	})
+	q.callers.Store(&data, ctx)
+
+	if err := q.queue(&data); err != nil {
+		q.waiters.Delete(&data)
+		q.callers.Delete(&data)
+		return err
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		q.waiters.Delete(&data)
+		return ctx.Err()
+	}
+}
+
+// mergeJobOptions applies the per-call options on top of the queue defaults.
+func (q *Queue) mergeJobOptions(opts ...job.AllowOption) job.AllowOption {
+	return job.MergeOptions(append([]job.AllowOption{q.jobOptions}, opts...)...)
+}
+
+// QueueTo queues a single job with binary like Queue, but to the given
+// worker instead of letting the queue pick one. The worker must be the one
+// of the queue or one of the workers behind a MultiWorker or a
+// BalancedWorker set with WithWorker, otherwise ErrUnknownWorker is returned.
+func (q *Queue) QueueTo(worker core.Worker, message core.QueuedMessage, opts ...job.AllowOption) error {
+	if message == nil {
+		return ErrNilMessage
+	}
+	push, err := q.route(worker)
+	if err != nil {
+		return err
+	}
+	data := job.NewMessage(message, q.mergeJobOptions(opts...))
+
+	return q.enqueue(&data, worker, push)
+}
+
+// route returns the function queueing a task to worker.
+func (q *Queue) route(worker core.Worker) (func(core.TaskMessage) error, error) {
+	if worker == nil {
+		return nil, ErrUnknownWorker
+	}
+	if worker == q.worker {
+		return q.worker.Queue, nil
+	}
+	if r, ok := q.worker.(interface {
+		queueTo(core.Worker, core.TaskMessage) error
+		has(core.Worker) bool
+	}); ok && r.has(worker) {
+		return func(task core.TaskMessage) error {
+			return r.queueTo(worker, task)
+		}, nil
+	}
+	return nil, ErrUnknownWorker
+}
+
 func (q *Queue) queue(m *job.Message) error {
+	return q.enqueue(m, q.worker, q.pusher(m))
+}
+
+// pusher returns the function queueing m to the worker.
+func (q *Queue) pusher(m *job.Message) func(core.TaskMessage) error {
+	// let the backend drop the message once it is too old
+	if t, ok := q.worker.(core.TTLQueuer); ok && m.MaxAge > 0 {
+		return func(task core.TaskMessage) error {
+			return t.QueueWithTTL(task, m.MaxAge)
+		}
+	}
+	return q.worker.Queue
+}
+
+// enqueue hands m over to push, worker is the one that ends up holding it.
+func (q *Queue) enqueue(m *job.Message, worker core.Worker, push func(core.TaskMessage) error) error {
+	// a shutdown waits for the submissions that passed the check below
+	q.submit.RLock()
+	defer q.submit.RUnlock()
 	if atomic.LoadInt32(&q.stopFlag) == 1 {
 		return ErrQueueShutdown
 	}
 
-	if err := q.worker.Queue(m); err != nil {
-		return err
+	if m.Task != nil && !isLocal(worker) {
+		return ErrTaskNotSerializable
+	}
+
+	// remote workers get the payload of streamed messages as a whole
+	if m.Stream != nil && !isLocal(worker) {
+		body, err := io.ReadAll(m.Stream)
+		if err != nil {
+			return err
+		}
+		m.Body, m.Stream = body, nil
+	}
+
+	if q.maxPayload > 0 && len(m.Body) > q.maxPayload {
+		return ErrPayloadTooLarge
+	}
+
+	if m.ID != "" {
+		q.status.set(m.ID, JobPending)
+	}
+
+	m.EnqueuedAt = q.clock.Now()
+	if err := push(m); err != nil {
+		if m.ID != "" {
+			q.status.remove(m.ID)
+		}
+		return newQueueError(err)
 	}
 
 	q.metric.IncSubmittedTask()
+	q.debugf("job %q enqueued", m.ID)
 
 	return nil
 }
 
-func (q *Queue) work(task core.TaskMessage) {
+// work handles task and returns the next job of its partition, which takes
+// over the busy worker, or nil.
+func (q *Queue) work(task core.TaskMessage) (next core.TaskMessage) {
 	var err error
+	var attempts int32
+	var requeued bool
+	id := q.acquireSlot()
+	startTime := q.clock.Now()
 	// to handle panic cases from inside the worker
 	// in such case, we start a new goroutine
 	defer func() {
-		q.metric.DecBusyWorker()
+		q.releaseSlot(id)
+		q.limits.release(task)
+		next = q.partitions.next(partitionKey(task))
+		if next != nil && !q.limits.acquire(next) {
+			next = nil
+		}
+		// or a parked job its limits no longer hold back
+		if next == nil {
+			next = q.limits.next()
+		}
+		if next == nil {
+			atomic.AddInt64(&q.busy, -1)
+			q.metric.DecBusyWorker()
+		}
+		q.spawnReady()
 		e := recover()
 		if e != nil {
 			q.logger.Fatalf("panic error: %v", e)
 		}
 		q.schedule()
 
+		// the job gets another turn, it is not finished
+		if requeued {
+			q.debugf("job %q requeued", jobID(task))
+			// the decoded copy was queued again, settle the raw task
+			if _, ok := task.(*job.Message); !ok {
+				q.finish(task, nil)
+			}
+			return
+		}
+
 		// increase success or failure number
-		if err == nil && e == nil {
+		decodeErr := errors.Is(err, ErrDecodeMessage)
+		expired := errors.Is(err, ErrJobExpired)
+		outcome := JobSucceeded
+		switch {
+		case decodeErr && q.decodePolicy == DecodeDrop:
+			q.metric.IncDroppedTask()
+			outcome = JobFailed
+		case expired:
+			q.metric.IncExpiredTask()
+			outcome = JobFailed
+		case err == nil && e == nil:
 			q.metric.IncSuccessTask()
-		} else {
+			q.throughput.record()
+		default:
 			q.metric.IncFailureTask()
+			q.metric.IncFailureType(failureType(err, e != nil))
+			q.throughput.record()
+			outcome = JobFailed
+		}
+		q.setStatus(task, outcome)
+		elapsed := q.clock.Now().Sub(startTime)
+		q.debugf("job %q finished on worker %d: %s in %s", jobID(task), id, outcome, elapsed)
+		q.emit(Event{
+			ID:       jobID(task),
+			Outcome:  outcome,
+			Duration: elapsed,
+			Attempt:  int(atomic.LoadInt32(&attempts)),
+		})
+		if e != nil && err == nil {
+			err = fmt.Errorf("panic error: %v", e)
+		}
+		if q.summarize != nil {
+			if line := q.summarize(task, err); line != "" {
+				q.logger.Info(line)
+			}
+		}
+		deadLettered := err != nil && q.deadLetter != nil && !expired &&
+			(!decodeErr || q.decodePolicy == DecodeDeadLetter)
+		if deadLettered {
+			q.deadLetter(task, err)
+			q.metric.IncDeadLetteredTask()
+		}
+		if expired || deadLettered || (decodeErr && q.decodePolicy == DecodeDrop) {
+			q.finish(task, nil)
+		} else {
+			q.finish(task, err)
 		}
+		q.notify(task, err)
 		if q.afterFn != nil {
 			q.afterFn()
 		}
+
+		// fail fast and let the supervisor restart the process
+		if e != nil && q.panicPolicy == PanicCrash {
+			panic(e)
+		}
 	}()
 
-	if err = q.run(task); err != nil {
+	// bound the jobs being handled at once, whatever the worker count
+	if q.inFlight != nil {
+		q.inFlight <- struct{}{}
+		defer func() { <-q.inFlight }()
+	}
+
+	if m, ok := task.(*job.Message); ok && !m.EnqueuedAt.IsZero() {
+		waited := q.clock.Now().Sub(m.EnqueuedAt)
+		q.metric.ObserveWaitTime(waited)
+		// too old to be worth running
+		if m.MaxAge > 0 && waited > m.MaxAge {
+			q.logger.Infof("job %q expired after waiting %s", m.ID, waited)
+			err = fmt.Errorf("%w: waited %s", ErrJobExpired, waited)
+			return
+		}
+	}
+	q.setStatus(task, JobRunning)
+	q.debugf("job %q started on worker %d", jobID(task), id)
+	ctx, cancel := q.withCaller(job.ContextWithWorkerID(context.Background(), id), task)
+	defer cancel()
+	if jobID := jobID(task); jobID != "" {
+		var stop context.CancelFunc
+		ctx, stop = context.WithCancel(ctx)
+		// store a pointer, funcs can't be compared on delete
+		q.running.Store(jobID, &stop)
+		defer func() {
+			q.running.CompareAndDelete(jobID, &stop)
+			stop()
+		}()
+	}
+	ctx = withAttemptCounter(ctx, &attempts)
+	stopLease := q.keepLease(ctx, task)
+	err = q.run(ctx, task)
+	stopLease()
+	// the backend or the queue runs the retry later on
+	if errors.Is(err, errRetryDelegated) {
+		err = nil
+		requeued = true
+		q.setStatus(task, JobPending)
+		return
+	}
+	if err == nil && q.acker != nil {
+		q.acker.add(task)
+	}
+	if err != nil {
 		q.logger.Errorf("runtime error: %s", err.Error())
+		requeued = q.requeue(task, err)
+	}
+	return
+}
+
+// requeue pushes a failed job back onto the queue after the requeue delay,
+// as set by WithRequeueOnFailure. It reports false when the job can't be
+// requeued and fails as usual.
+func (q *Queue) requeue(task core.TaskMessage, err error) bool {
+	m, ok := task.(*job.Message)
+	if !ok || m.Requeues >= q.maxRequeues || !isLocal(q.worker) ||
+		errors.Is(err, context.Canceled) || atomic.LoadInt32(&q.stopFlag) == 1 {
+		return false
+	}
+
+	m.Requeues++
+	q.metric.IncRetriedTask()
+	q.requeueAfter(m, q.requeueDelay, err)
+	return true
+}
+
+// requeueAfter queues m again once delay has passed, or at once when the
+// queue shuts down. The job fails with err if it can't be queued.
+func (q *Queue) requeueAfter(m *job.Message, delay time.Duration, err error) {
+	q.setStatus(m, JobPending)
+	// settled before it can be handed out again
+	q.finish(m, nil)
+	q.routineGroup.Run(func() {
+		select {
+		case <-q.clock.After(delay):
+		case <-q.quit:
+		}
+		if qerr := q.queue(m); qerr != nil {
+			q.logger.Errorf("requeue job %q: %s", m.ID, qerr.Error())
+			q.fail(m, err)
+		}
+	})
+}
+
+// fail finishes a job that failed outside of a worker, e.g. because it
+// could not be queued again.
+func (q *Queue) fail(task core.TaskMessage, err error) {
+	q.metric.IncFailureTask()
+	q.metric.IncFailureType(failureType(err, false))
+	q.setStatus(task, JobFailed)
+	if q.deadLetter != nil {
+		q.deadLetter(task, err)
+		q.metric.IncDeadLetteredTask()
+	}
+	q.notify(task, err)
+}
+
+// debugf logs a debug message to loggers implementing DebugLogger.
+func (q *Queue) debugf(format string, args ...interface{}) {
+	if l, ok := q.logger.(DebugLogger); ok {
+		l.Debugf(format, args...)
+	}
+}
+
+// finish reports the outcome of a task handed out by the worker to workers
+// implementing core.Finisher.
+func (q *Queue) finish(task core.TaskMessage, err error) {
+	if f, ok := q.worker.(core.Finisher); ok {
+		f.Finish(task, err)
+	}
+}
+
+// dropped fails a job the worker discarded after accepting it, see
+// core.DropNotifier.
+func (q *Queue) dropped(task core.TaskMessage) {
+	q.logger.Infof("job %q dropped by the worker", jobID(task))
+	q.metric.IncDroppedTask()
+	q.setStatus(task, JobFailed)
+	if m, ok := task.(*job.Message); ok {
+		q.callers.Delete(m)
+	}
+	q.notify(task, ErrTaskDropped)
+}
+
+// Cancel stops the job with the given ID. A job still buffered by the worker,
+// or waiting for its concurrency limits, is removed and never runs, a caller
+// waiting on it gets context.Canceled. A running job has its context
+// cancelled. It reports whether the job was found. Buffered jobs can only be
+// removed from workers with a Remove(id string) (core.TaskMessage, bool)
+// method, such as Ring.
+func (q *Queue) Cancel(id string) bool {
+	if m, ok := q.limits.remove(id); ok {
+		q.status.remove(id)
+		q.callers.Delete(m)
+		q.finish(m, nil)
+		q.notify(m, context.Canceled)
+		// the jobs of its partition waited for it
+		if next := q.partitions.next(m.PartitionKey); next != nil && q.limits.acquire(next) {
+			q.spawn(next)
+		}
+		return true
+	}
+
+	if r, ok := q.worker.(interface {
+		Remove(id string) (core.TaskMessage, bool)
+	}); ok {
+		if task, ok := r.Remove(id); ok {
+			q.status.remove(id)
+			if m, ok := task.(*job.Message); ok {
+				q.callers.Delete(m)
+			}
+			q.notify(task, context.Canceled)
+			return true
+		}
+	}
+
+	if stop, ok := q.running.Load(id); ok {
+		(*stop.(*context.CancelFunc))()
+		return true
+	}
+	return false
+}
+
+// isLocal reports whether w handles its tasks in this process.
+func isLocal(w core.Worker) bool {
+	if l, ok := w.(core.LocalWorker); ok {
+		return l.Local()
+	}
+	return true
+}
+
+// setStatus records the status of task when it carries a job ID.
+func (q *Queue) setStatus(task core.TaskMessage, status JobStatus) {
+	if id := jobID(task); id != "" {
+		q.status.set(id, status)
+	}
+}
+
+// jobID returns the ID of task, or an empty string when it has none.
+func jobID(task core.TaskMessage) string {
+	if m, ok := task.(*job.Message); ok {
+		return m.ID
 	}
+	return ""
 }
 
-func (q *Queue) run(task core.TaskMessage) error {
+// notify reports the final result of task to the caller
+// waiting on it, if any, and frees its ID for QueueIfAbsent.
+func (q *Queue) notify(task core.TaskMessage, err error) {
+	m, ok := task.(*job.Message)
+	if !ok {
+		return
+	}
+	if m.ID != "" {
+		q.present.Delete(m.ID)
+	}
+	if fn, ok := q.waiters.LoadAndDelete(m); ok {
+		fn.(func(error))(err)
+	}
+}
+
+// withCaller returns a copy of ctx that is cancelled together with the
+// context task was submitted with, if any.
+func (q *Queue) withCaller(ctx context.Context, task core.TaskMessage) (context.Context, context.CancelFunc) {
+	m, ok := task.(*job.Message)
+	if !ok {
+		return ctx, func() {}
+	}
+	caller, ok := q.callers.LoadAndDelete(m)
+	if !ok {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	// AfterFunc runs asynchronously, cancel right away when the caller
+	// is already gone so the job doesn't start
+	if caller.(context.Context).Err() != nil {
+		cancel()
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(caller.(context.Context), cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+func (q *Queue) run(ctx context.Context, task core.TaskMessage) error {
 	switch t := task.(type) {
 	case *job.Message:
-		return q.handle(t)
+		return q.handle(ctx, t)
 	default:
-		return errors.New("invalid task type")
+		// workers may hand out the raw message, decode it first
+		m := &job.Message{}
+		if err := json.Unmarshal(task.Bytes(), m); err != nil {
+			return fmt.Errorf("%w: %w", ErrDecodeMessage, err)
+		}
+		// its limits are only known now, wait for them on the worker
+		if err := q.limits.wait(ctx, m); err != nil {
+			return err
+		}
+		defer q.limits.release(m)
+		return q.handle(ctx, m)
 	}
 }
 
-func (q *Queue) handle(m *job.Message) error {
+func (q *Queue) handle(ctx context.Context, m *job.Message) (err error) {
+	startTime := q.clock.Now()
+	// report timeouts together with the job details
+	defer func() {
+		var timeoutErr *job.TimeoutError
+		if errors.Is(err, context.DeadlineExceeded) && !errors.As(err, &timeoutErr) &&
+			!errors.Is(err, ErrCancelledOnShutdown) {
+			err = &job.TimeoutError{ID: m.ID, Elapsed: q.clock.Now().Sub(startTime)}
+		}
+	}()
+
+	// the caller may have given up before the job started
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(m.Headers) > 0 {
+		ctx = job.ContextWithHeaders(ctx, m.Headers)
+	}
+
+	if q.timeoutFn != nil {
+		d := q.timeoutFn(m)
+		if d <= 0 {
+			return fmt.Errorf("%w: %s", ErrInvalidTimeout, d)
+		}
+		m.Timeout = d
+	}
+
+	// without deadline to watch, the job can run on the worker goroutine
+	if q.inline && m.Timeout <= 0 && m.TotalTimeout <= 0 {
+		defer func() {
+			if p := recover(); p != nil {
+				q.breaker.report(fmt.Errorf("panic error: %v", p))
+				panic(p)
+			}
+		}()
+		return q.runAttempts(ctx, m)
+	}
+
 	// create channel with buffer size 1 to avoid goroutine leak
 	done := make(chan error, 1)
 	panicChan := make(chan interface{}, 1)
-	startTime := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	// when a total timeout is set, it bounds the whole retry sequence
+	// and Timeout only applies to a single attempt.
+	timeout := m.Timeout
+	if m.TotalTimeout > 0 {
+		timeout = m.TotalTimeout
+	}
+	ctx, cancel := withTimeout(ctx, q.clock, timeout)
 	defer func() {
 		cancel()
 	}()
 
+	// report the job once it outlives its soft timeout
+	if q.slowTask != nil && m.SoftTimeout > 0 && m.SoftTimeout < timeout {
+		soft := q.clock.After(m.SoftTimeout)
+		go func() {
+			select {
+			case <-soft:
+				if ctx.Err() == nil {
+					q.slowTask(m, q.clock.Now().Sub(startTime))
+				}
+			case <-ctx.Done():
+			}
+		}()
+	}
+
 	// run the job
-	go func() {
+	q.handlers.Go(func() {
 		// handle panic issue
 		defer func() {
 			if p := recover(); p != nil {
+				// only an attempt the breaker allowed can panic
+				q.breaker.report(fmt.Errorf("panic error: %v", p))
 				panicChan <- p
 			}
 		}()
 
-		// run custom process function
-		var err error
-
-		b := &backoff.Backoff{
-			Min:    m.RetryMin,
-			Max:    m.RetryMax,
-			Factor: m.RetryFactor,
-			Jitter: m.Jitter,
-		}
-		delay := m.RetryDelay
-	loop:
-		for {
-			if m.Task != nil {
-				err = m.Task(ctx)
-			} else {
-				err = q.worker.Run(ctx, m)
-			}
-
-			// check error and retry count
-			if err == nil || m.RetryCount == 0 {
-				break
-			}
-			m.RetryCount--
-
-			if m.RetryDelay == 0 {
-				delay = b.Duration()
-			}
-
-			select {
-			case <-time.After(delay): // retry delay
-				q.logger.Infof("retry remaining times: %d, delay time: %s", m.RetryCount, delay)
-			case <-ctx.Done(): // timeout reached
-				err = ctx.Err()
-				break loop
-			}
-		}
-
-		done <- err
-	}()
+		done <- q.runAttempts(ctx, m)
+	})
 
+	// select picks at random among the ready cases, a job that finished
+	// keeps its result over a timeout or a shutdown ready at the same time
 	select {
 	case p := <-panicChan:
 		panic(p)
 	case <-ctx.Done(): // timeout reached
+		select {
+		case err := <-done:
+			return err
+		default:
+		}
 		return ctx.Err()
 	case <-q.quit: // shutdown service
+		select {
+		case err := <-done:
+			return err
+		default:
+		}
 		// cancel job
 		cancel()
 
-		leftTime := m.Timeout - time.Since(startTime)
+		leftTime := timeout - q.clock.Now().Sub(startTime)
 		// wait job
 		select {
-		case <-time.After(leftTime):
-			return context.DeadlineExceeded
-		case err := <-done: // job finish
-			return err
+		case <-q.clock.After(leftTime):
+			select {
+			case err = <-done:
+			default:
+				err = &job.TimeoutError{ID: m.ID, Elapsed: q.clock.Now().Sub(startTime)}
+			}
+		case err = <-done: // job finish
 		case p := <-panicChan:
 			panic(p)
 		}
+		// mark the failure so that the dead-letter sink can tell it apart
+		if err != nil {
+			err = fmt.Errorf("%w: %w", ErrCancelledOnShutdown, err)
+		}
+		return err
 	case err := <-done: // job finish
 		return err
 	}
 }
 
-// UpdateWorkerCount to update worker number dynamically.
+// runAttempts runs m until it succeeds or its retries are used up, and
+// returns the error of the last attempt.
+func (q *Queue) runAttempts(ctx context.Context, m *job.Message) error {
+	var err error
+
+	b := &backoff.Backoff{
+		Min:    m.RetryMin,
+		Max:    m.RetryMax,
+		Factor: m.RetryFactor,
+		Jitter: m.Jitter,
+	}
+	delay := m.RetryDelay
+	// a redelivered retry carries on with the attempts of the job
+	maxAttempts := int(m.RetryCount) + 1
+	if m.MaxAttempts > 0 {
+		maxAttempts = m.MaxAttempts
+	}
+	for number := m.Attempt + 1; ; number++ {
+		countAttempt(ctx, number)
+		attemptCtx, attemptCancel := ctx, context.CancelFunc(func() {})
+		if m.TotalTimeout > 0 {
+			attemptCtx, attemptCancel = withTimeout(ctx, q.clock, m.Timeout)
+		}
+		attemptCtx = job.ContextWithAttempt(attemptCtx, number, maxAttempts)
+
+		// an open breaker fails the job at once, without retry
+		if !q.breaker.allow() {
+			attemptCancel()
+			err = ErrCircuitOpen
+			break
+		}
+
+		// the task function of the message takes precedence over
+		// the run function of the worker
+		if m.Task != nil {
+			err = m.Task(attemptCtx)
+		} else {
+			err = q.worker.Run(attemptCtx, m)
+		}
+		attemptCancel()
+		q.breaker.report(err)
+
+		// check error and retry count
+		if err == nil || m.RetryCount == 0 {
+			break
+		}
+		m.RetryCount--
+		q.metric.IncRetriedTask()
+
+		if m.RetryDelay == 0 {
+			delay = b.ForAttempt(float64(number - 1))
+		}
+
+		// free the worker and let the backend deliver the retry
+		if r, ok := q.worker.(core.DelayedRequeuer); ok && m.Task == nil {
+			m.Attempt, m.MaxAttempts = number, maxAttempts
+			rerr := r.RequeueAfter(m, delay)
+			if rerr == nil {
+				q.finish(m, nil)
+				err = errRetryDelegated
+				break
+			}
+			m.Attempt, m.MaxAttempts = 0, 0
+			q.logger.Errorf("requeue job %q with delay: %s", m.ID, rerr.Error())
+		}
+
+		// submit the retry to the queue again and free the worker
+		if q.retryMode == RetryRequeue {
+			m.Attempt, m.MaxAttempts = number, maxAttempts
+			q.requeueAfter(m, delay, err)
+			err = errRetryDelegated
+			break
+		}
+
+		select {
+		case <-q.clock.After(delay): // retry delay
+			q.logger.Infof("retry remaining times: %d, delay time: %s", m.RetryCount, delay)
+		case <-ctx.Done(): // timeout reached
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// acquireSlot reserves the lowest free worker slot and returns its index.
+func (q *Queue) acquireSlot() int {
+	q.Lock()
+	defer q.Unlock()
+	for i, busy := range q.slots {
+		if !busy {
+			q.slots[i] = true
+			return i
+		}
+	}
+	q.slots = append(q.slots, true)
+	return len(q.slots) - 1
+}
+
+// releaseSlot frees the worker slot reserved by acquireSlot. Free slots
+// above the worker count are dropped so the table shrinks with the count.
+func (q *Queue) releaseSlot(id int) {
+	q.Lock()
+	q.slots[id] = false
+	n := len(q.slots)
+	for n > 0 && int64(n) > q.effectiveWorkerCount() && !q.slots[n-1] {
+		n--
+	}
+	q.slots = q.slots[:n]
+	q.Unlock()
+}
+
+// Workers returns the number of live workers. While the queue runs it is the
+// worker count, clamped by WithCPUScaling if set, or the number of busy
+// workers when more of them are still finishing their job after the count
+// was lowered. It is zero before Start, and once the queue is shut down only
+// the workers finishing their job are counted.
+func (q *Queue) Workers() int {
+	q.Lock()
+	defer q.Unlock()
+	n := 0
+	for _, busy := range q.slots {
+		if busy {
+			n++
+		}
+	}
+
+	select {
+	case <-q.started:
+	default:
+		return n
+	}
+	if atomic.LoadInt32(&q.stopFlag) == 1 {
+		return n
+	}
+	if count := int(q.effectiveWorkerCount()); count > n {
+		return count
+	}
+	return n
+}
+
+// UpdateWorkerCount to update worker number dynamically. Lowering the count
+// lets the surplus workers finish their current job, no new job is started
+// until fewer workers than the new count are busy. The CPU limit set by
+// WithCPUScaling still applies.
 func (q *Queue) UpdateWorkerCount(num int64) {
 	q.Lock()
 	q.workerCount = num
@@ -279,11 +1436,25 @@ func (q *Queue) UpdateWorkerCount(num int64) {
 	q.schedule()
 }
 
-// schedule to check worker number
-func (q *Queue) schedule() {
+// RetireOneWorker lowers the worker count by one. A busy worker finishes
+// its current job before it exits and isn't replaced, the rest of the queue
+// keeps running. A worker count above the CPU limit set by WithCPUScaling
+// is lowered to the limit first, so that a live worker is always retired.
+// It returns false when no worker is left.
+func (q *Queue) RetireOneWorker() bool {
 	q.Lock()
 	defer q.Unlock()
-	if q.BusyWorkers() >= q.workerCount {
+	q.workerCount = q.effectiveWorkerCount()
+	if q.workerCount <= 0 {
+		return false
+	}
+	q.workerCount--
+	return true
+}
+
+// schedule to check worker number
+func (q *Queue) schedule() {
+	if !q.hasCapacity() {
 		return
 	}
 
@@ -293,63 +1464,262 @@ func (q *Queue) schedule() {
 	}
 }
 
+// hasCapacity reports whether fewer workers are busy than configured.
+func (q *Queue) hasCapacity() bool {
+	q.Lock()
+	defer q.Unlock()
+	return atomic.LoadInt64(&q.busy) < q.effectiveWorkerCount()
+}
+
+// Saturation returns the share of the workers busy running a job, from 0
+// to 1, the worker count being clamped by WithCPUScaling if set. It is 0
+// without any worker and stays at 1 while more jobs run than a lowered
+// worker count allows.
+func (q *Queue) Saturation() float64 {
+	q.Lock()
+	n := q.effectiveWorkerCount()
+	q.Unlock()
+	if n <= 0 {
+		return 0
+	}
+	busy := atomic.LoadInt64(&q.busy)
+	if busy >= n {
+		return 1
+	}
+	return float64(busy) / float64(n)
+}
+
+// effectiveWorkerCount returns the worker count clamped by the CPU limit.
+// The caller must hold the lock.
+func (q *Queue) effectiveWorkerCount() int64 {
+	if q.cpuLimit > 0 && q.cpuLimit < q.workerCount {
+		return q.cpuLimit
+	}
+	return q.workerCount
+}
+
+// idleWorkers returns the number of workers not running a job, at least
+// one.
+func (q *Queue) idleWorkers() int {
+	q.Lock()
+	defer q.Unlock()
+	n := int(q.effectiveWorkerCount() - atomic.LoadInt64(&q.busy))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// request fetches the next tasks from the worker. Workers implementing
+// core.BatchRequester are asked for as many tasks as there are idle workers,
+// workers implementing core.ContextRequester wait for a task to arrive.
+func (q *Queue) request() ([]core.TaskMessage, error) {
+	cw, blocking := q.worker.(core.ContextRequester)
+	if w, ok := q.worker.(core.BatchRequester); ok {
+		tasks, err := w.RequestBatch(q.idleWorkers())
+		if len(tasks) > 0 || !blocking || !errors.Is(err, ErrNoTaskInQueue) {
+			atomic.AddUint64(&q.requested, uint64(len(tasks)))
+			return tasks, err
+		}
+	}
+
+	var t core.TaskMessage
+	var err error
+	if blocking {
+		// held jobs of a resumed topic can't wait for the worker
+		ctx, cancel := context.WithCancel(q.requestCtx)
+		q.Lock()
+		q.interrupt = cancel
+		if len(q.topics.resumed) > 0 {
+			cancel()
+		}
+		q.Unlock()
+		t, err = cw.RequestWithContext(ctx)
+		cancel()
+	} else {
+		t, err = q.worker.Request()
+	}
+	if t == nil {
+		return nil, err
+	}
+	atomic.AddUint64(&q.requested, 1)
+	return []core.TaskMessage{t}, err
+}
+
 // start to start all worker
 func (q *Queue) start() {
-	tasks := make(chan core.TaskMessage, 1)
+	q.startedOnce.Do(func() {
+		close(q.started)
+	})
 
 	for {
-		// check worker number
-		q.schedule()
+		// a ready signal may stand for several freed workers, so keep
+		// fetching while one is idle and only wait when all are busy
+		if !q.hasCapacity() {
+			select {
+			case <-q.ready:
+				continue
+			case <-q.quit:
+				return
+			}
+		}
 
 		select {
-		// wait worker ready
-		case <-q.ready:
 		case <-q.quit:
 			return
+		default:
 		}
 
-		// request task from queue in background
-		q.routineGroup.Run(func() {
-			for {
-				t, err := q.worker.Request()
-				if t == nil || err != nil {
-					if err != nil {
-						select {
-						case <-q.quit:
-							if !errors.Is(err, ErrNoTaskInQueue) {
-								close(tasks)
-								return
-							}
-						case <-time.After(time.Second):
-							// sleep 1 second to fetch new task
-						}
-					}
-				}
-				if t != nil {
-					tasks <- t
-					return
-				}
-
-				select {
-				case <-q.quit:
-					if !errors.Is(err, ErrNoTaskInQueue) {
-						close(tasks)
-						return
-					}
-				default:
-				}
-			}
-		})
-
-		task, ok := <-tasks
+		// fetch tasks and hand them straight to new workers, a slow
+		// job never holds up the next fetch
+		batch, ok := q.fetch()
 		if !ok {
 			return
 		}
 
 		// start new task
-		q.metric.IncBusyWorker()
-		q.routineGroup.Run(func() {
-			q.work(task)
-		})
+		for _, task := range batch {
+			q.launch(task)
+		}
+		atomic.StoreInt32(&q.fetching, 0)
+	}
+}
+
+// launch hands task to a new worker.
+func (q *Queue) launch(task core.TaskMessage) {
+	// jobs of a running partition wait for it without holding a worker,
+	// so that a busy partition doesn't starve the others
+	if q.partitions.enqueue(task) {
+		return
+	}
+	// and so do the jobs over their concurrency limits
+	if !q.limits.acquire(task) {
+		return
+	}
+	q.spawn(task)
+}
+
+// spawn runs task, which holds its limits, on a new worker.
+func (q *Queue) spawn(task core.TaskMessage) {
+	atomic.AddInt64(&q.busy, 1)
+	q.metric.IncBusyWorker()
+	q.routineGroup.Run(func() {
+		q.dispatch(task)
+	})
+}
+
+// spawnReady runs the parked jobs their limits no longer hold back on the
+// idle workers. The ones left are taken over by the next worker to finish.
+func (q *Queue) spawnReady() {
+	for q.hasCapacity() {
+		task := q.limits.next()
+		if task == nil {
+			return
+		}
+		q.spawn(task)
+	}
+}
+
+// requestOne returns the next held job of a resumed topic, or else requests
+// a single task from the worker.
+func (q *Queue) requestOne() (core.TaskMessage, error) {
+	if held := q.resumed(1); len(held) > 0 {
+		return held[0], nil
+	}
+	task, err := q.worker.Request()
+	if task != nil {
+		atomic.AddUint64(&q.requested, 1)
+	}
+	return task, err
+}
+
+// Tick requests a single task from the worker and hands it to a new
+// worker, for queues created with WithManualDispatch. It reports whether a
+// task was dispatched, which is not the case when the queue is shut down,
+// every worker is busy or the worker has no task.
+func (q *Queue) Tick() bool {
+	if atomic.LoadInt32(&q.stopFlag) == 1 || !q.hasCapacity() {
+		return false
+	}
+	task, err := q.requestOne()
+	if task == nil {
+		return false
+	}
+	if err != nil {
+		q.logger.Errorf("request returned a task with error: %s", err.Error())
+	}
+	q.debugf("job %q requested", jobID(task))
+	if held, _ := q.hold(task); held {
+		return false
+	}
+	q.launch(task)
+	return true
+}
+
+// fetch requests tasks from the worker until it gets some. It returns
+// an empty batch when there is no idle worker left and false once the
+// queue is shutting down.
+func (q *Queue) fetch() ([]core.TaskMessage, bool) {
+	// with WithIdleBackoff the wait doubles while the worker stays empty
+	var idle *backoff.Backoff
+	if q.idleMin > 0 {
+		idle = &backoff.Backoff{Min: q.idleMin, Max: q.idleMax, Factor: 2}
+	}
+	// jobs of paused topics handed back since the last wait
+	skipped := 0
+
+	for {
+		// the worker count may have been lowered since the ready
+		// signal was sent, give up and wait for the next one
+		if !q.hasCapacity() {
+			return nil, true
+		}
+
+		atomic.StoreInt32(&q.fetching, 1)
+		// the held jobs of resumed topics come before the worker's
+		if t := q.resumed(q.idleWorkers()); len(t) > 0 {
+			return t, true
+		}
+		t, err := q.request()
+		// tasks handed out are always run, even along with an error
+		if len(t) > 0 {
+			if err != nil {
+				q.logger.Errorf("request returned %d tasks with error: %s", len(t), err.Error())
+			}
+			for _, task := range t {
+				q.debugf("job %q requested", jobID(task))
+			}
+			// jobs of paused topics go back to the worker, which is
+			// only polled again at once if it holds other jobs
+			var handedBack int
+			if t, handedBack = q.unheld(t); len(t) > 0 {
+				return t, true
+			}
+			skipped += handedBack
+			if l := q.Len(); handedBack == 0 || (l >= 0 && skipped < l) {
+				continue
+			}
+		}
+		atomic.StoreInt32(&q.fetching, 0)
+
+		// nothing to run: wait before polling the worker again. Once the
+		// queue is shut down, only an empty worker still being drained
+		// is polled again.
+		wait := q.pollInterval
+		if idle != nil {
+			wait = idle.Duration()
+		}
+		select {
+		case <-q.quit:
+			if !errors.Is(err, ErrNoTaskInQueue) {
+				return nil, false
+			}
+		case <-q.clock.After(wait):
+		case <-q.wake:
+			if idle != nil {
+				idle.Reset()
+			}
+		}
+		skipped = 0
 	}
 }
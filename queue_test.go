@@ -3,6 +3,14 @@ package queue
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,6 +18,7 @@ import (
 	"github.com/golang-queue/queue/core"
 	"github.com/golang-queue/queue/job"
 	"github.com/golang-queue/queue/mocks"
+	"github.com/golang-queue/queue/queuetest"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/goleak"
@@ -50,7 +59,7 @@ func TestNewQueueWithZeroWorker(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, q)
 
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(50 * time.Millisecond)
 	assert.Equal(t, int64(0), q.BusyWorkers())
 	q.Release()
@@ -77,7 +86,7 @@ func TestNewQueueWithDefaultWorker(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, q)
 
-	q.Start()
+	assert.NoError(t, q.Start())
 	q.Release()
 	assert.Equal(t, int64(0), q.BusyWorkers())
 }
@@ -100,18 +109,18 @@ func TestHandleTimeout(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, q)
 
-	err = q.handle(m)
+	err = q.handle(context.Background(), m)
 	assert.Error(t, err)
-	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
 
 	done := make(chan error)
 	go func() {
-		done <- q.handle(m)
+		done <- q.handle(context.Background(), m)
 	}()
 
 	err = <-done
 	assert.Error(t, err)
-	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
 }
 
 func TestJobComplete(t *testing.T) {
@@ -131,7 +140,7 @@ func TestJobComplete(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, q)
 
-	err = q.handle(m)
+	err = q.handle(context.Background(), m)
 	assert.Error(t, err)
 	assert.Equal(t, errors.New("job completed"), err)
 
@@ -153,7 +162,7 @@ func TestJobComplete(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, q)
 
-	err = q.handle(m)
+	err = q.handle(context.Background(), m)
 	assert.Error(t, err)
 	assert.Equal(t, errors.New("job completed"), err)
 }
@@ -173,7 +182,7 @@ func TestTaskJobComplete(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, q)
 
-	err = q.handle(m)
+	err = q.handle(context.Background(), m)
 	assert.Error(t, err)
 	assert.Equal(t, errors.New("job completed"), err)
 
@@ -184,7 +193,7 @@ func TestTaskJobComplete(t *testing.T) {
 		},
 	}
 
-	assert.NoError(t, q.handle(m))
+	assert.NoError(t, q.handle(context.Background(), m))
 
 	// job timeout
 	m = &job.Message{
@@ -194,7 +203,7 @@ func TestTaskJobComplete(t *testing.T) {
 			return nil
 		},
 	}
-	assert.Equal(t, context.DeadlineExceeded, q.handle(m))
+	assert.ErrorIs(t, q.handle(context.Background(), m), context.DeadlineExceeded)
 }
 
 func TestMockWorkerAndMessage(t *testing.T) {
@@ -202,12 +211,14 @@ func TestMockWorkerAndMessage(t *testing.T) {
 	defer controller.Finish()
 
 	m := mocks.NewMockTaskMessage(controller)
+	m.EXPECT().Bytes().Return([]byte("test")).AnyTimes()
 
 	w := mocks.NewMockWorker(controller)
 	w.EXPECT().Shutdown().Return(nil)
-	w.EXPECT().Request().DoAndReturn(func() (core.TaskMessage, error) {
+	first := w.EXPECT().Request().DoAndReturn(func() (core.TaskMessage, error) {
 		return m, errors.New("nil")
 	})
+	w.EXPECT().Request().Return(nil, nil).After(first).AnyTimes()
 
 	q, err := NewQueue(
 		WithWorker(w),
@@ -215,7 +226,3194 @@ func TestMockWorkerAndMessage(t *testing.T) {
 	)
 	assert.NoError(t, err)
 	assert.NotNil(t, q)
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(50 * time.Millisecond)
 	q.Release()
 }
+
+func TestHeadersInHandler(t *testing.T) {
+	headers := make(chan map[string]string, 2)
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			headers <- job.HeadersFromContext(ctx)
+			return nil
+		}))),
+		WithDefaultJobOptions(job.WithHeader("source", "api")),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"},
+		job.WithHeader("content-type", "application/json")))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		headers <- job.HeadersFromContext(ctx)
+		return nil
+	}, job.WithHeader("source", "cron")))
+	assert.NoError(t, q.Start())
+
+	assert.Equal(t, map[string]string{
+		"content-type": "application/json",
+		"source":       "api",
+	}, <-headers)
+	assert.Equal(t, map[string]string{"source": "cron"}, <-headers)
+	q.Release()
+}
+
+func TestWorkerIDInContext(t *testing.T) {
+	workerCount := 4
+	ids := make(chan int, workerCount)
+	release := make(chan struct{})
+
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(int64(workerCount)),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < workerCount; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			ids <- job.WorkerID(ctx)
+			<-release
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+
+	seen := make(map[int]bool)
+	for i := 0; i < workerCount; i++ {
+		id := <-ids
+		assert.GreaterOrEqual(t, id, 0)
+		assert.Less(t, id, workerCount)
+		assert.False(t, seen[id], "worker id %d used twice", id)
+		seen[id] = true
+	}
+	close(release)
+	q.Release()
+}
+
+func TestConcurrencyKey(t *testing.T) {
+	keys := []string{"user-1", "user-2", "user-3"}
+	jobsPerKey := 5
+
+	var mu sync.Mutex
+	active := make(map[string]int)
+	running, maxRunning := 0, 0
+	overlap := false
+	done := make(chan struct{}, len(keys)*jobsPerKey)
+
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(6),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < jobsPerKey; i++ {
+		for _, key := range keys {
+			key := key
+			assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+				mu.Lock()
+				active[key]++
+				running++
+				if active[key] > 1 {
+					overlap = true
+				}
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				active[key]--
+				running--
+				mu.Unlock()
+				done <- struct{}{}
+				return nil
+			}, job.WithConcurrencyKey(key)))
+		}
+	}
+
+	assert.NoError(t, q.Start())
+	for i := 0; i < len(keys)*jobsPerKey; i++ {
+		<-done
+	}
+	q.Release()
+
+	assert.False(t, overlap, "jobs sharing a key ran concurrently")
+	assert.Greater(t, maxRunning, 1, "distinct keys did not run in parallel")
+}
+
+func TestTotalTimeoutCutsRetries(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	var attempts int32
+	m := &job.Message{
+		Timeout:      time.Second,
+		TotalTimeout: 100 * time.Millisecond,
+		RetryCount:   10,
+		RetryDelay:   40 * time.Millisecond,
+		Task: func(ctx context.Context) error {
+			atomic.AddInt32(&attempts, 1)
+			return errors.New("always fail")
+		},
+	}
+
+	err = q.handle(context.Background(), m)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, atomic.LoadInt32(&attempts), int32(11))
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&attempts), int32(2))
+}
+
+func TestTotalTimeoutWithAttemptTimeout(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	var attempts int32
+	m := &job.Message{
+		Timeout:      30 * time.Millisecond,
+		TotalTimeout: 100 * time.Millisecond,
+		RetryCount:   5,
+		RetryDelay:   10 * time.Millisecond,
+		Task: func(ctx context.Context) error {
+			atomic.AddInt32(&attempts, 1)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	err = q.handle(context.Background(), m)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// every attempt hits its own deadline and is retried
+	// until the total deadline stops the sequence.
+	assert.Greater(t, atomic.LoadInt32(&attempts), int32(1))
+	assert.Less(t, atomic.LoadInt32(&attempts), int32(6))
+}
+
+func TestQueueTaskAndWait(t *testing.T) {
+	q := NewPool(2, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	called := false
+	assert.NoError(t, q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+		called = true
+		return nil
+	}))
+	assert.True(t, called)
+
+	err := q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+		return errors.New("task failed")
+	})
+	assert.EqualError(t, err, "task failed")
+}
+
+func TestQueueTaskAndWaitContextCanceled(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := q.QueueTaskAndWait(ctx, func(ctx context.Context) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestQueueTaskAndWaitAfterShutdown(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	q.Release()
+
+	err := q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+	assert.Equal(t, ErrQueueShutdown, err)
+}
+
+func TestDefaultJobOptions(t *testing.T) {
+	w := NewRing()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithDefaultJobOptions(job.AllowOption{
+			RetryCount: job.Int64(3),
+			Timeout:    job.Time(5 * time.Second),
+		}),
+	)
+	assert.NoError(t, err)
+
+	// defaults apply when omitted
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	task, err := w.Request()
+	assert.NoError(t, err)
+	m := task.(*job.Message)
+	assert.Equal(t, int64(3), m.RetryCount)
+	assert.Equal(t, 5*time.Second, m.Timeout)
+
+	// per-call options take precedence
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}, job.AllowOption{
+		Timeout: job.Time(time.Second),
+	}))
+	task, err = w.Request()
+	assert.NoError(t, err)
+	m = task.(*job.Message)
+	assert.Equal(t, int64(3), m.RetryCount)
+	assert.Equal(t, time.Second, m.Timeout)
+	// untouched fields keep their zero-value defaults
+	assert.Equal(t, 100*time.Millisecond, m.RetryMin)
+}
+
+func TestPanicPolicyRecover(t *testing.T) {
+	done := make(chan struct{})
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		panic("boom")
+	}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		close(done)
+		return nil
+	}))
+	assert.NoError(t, q.Start())
+	<-done
+	q.Release()
+
+	assert.Equal(t, uint64(1), q.FailureTasks())
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+}
+
+func TestPanicPolicyCrash(t *testing.T) {
+	if os.Getenv("QUEUE_PANIC_CRASH") == "1" {
+		q, _ := NewQueue(
+			WithWorker(NewRing()),
+			WithWorkerCount(1),
+			WithLogger(NewEmptyLogger()),
+			WithPanicPolicy(PanicCrash),
+		)
+		_ = q.QueueTask(func(ctx context.Context) error {
+			panic("boom")
+		})
+		assert.NoError(t, q.Start())
+		time.Sleep(5 * time.Second)
+		os.Exit(0)
+	}
+
+	// run the crashing queue in a subprocess and expect it to die
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPanicPolicyCrash$") //nolint:gosec
+	cmd.Env = append(os.Environ(), "QUEUE_PANIC_CRASH=1")
+	out, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	assert.ErrorAs(t, err, &exitErr)
+	assert.Contains(t, string(out), "panic: boom")
+}
+
+type lifecycleWorker struct {
+	*Ring
+	beforeErr error
+	afterRun  bool
+}
+
+func (w *lifecycleWorker) BeforeRun() error {
+	return w.beforeErr
+}
+
+func (w *lifecycleWorker) AfterRun() error {
+	w.afterRun = true
+	return nil
+}
+
+func TestBeforeRunAbortsStart(t *testing.T) {
+	w := &lifecycleWorker{
+		Ring:      NewRing(),
+		beforeErr: errors.New("connection refused"),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.EqualError(t, q.Start(), "connection refused")
+	q.Release()
+	// nothing to clean up, the worker never ran
+	assert.False(t, w.afterRun)
+}
+
+func TestAfterRunWithoutStart(t *testing.T) {
+	w := &lifecycleWorker{
+		Ring: NewRing(),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	q.Release()
+	assert.False(t, w.afterRun)
+}
+
+func TestBeforeRunStartsQueue(t *testing.T) {
+	w := &lifecycleWorker{
+		Ring: NewRing(),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, q.Start())
+	q.Release()
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+	assert.True(t, w.afterRun)
+}
+
+type failingShutdownWorker struct {
+	*Ring
+}
+
+func (w failingShutdownWorker) Shutdown() error {
+	if err := w.Ring.Shutdown(); err != nil {
+		return err
+	}
+	return errors.New("broker unreachable")
+}
+
+func TestShutdownE(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	ok, err := q.ShutdownE()
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	ok, err = q.ShutdownE()
+	assert.False(t, ok)
+	assert.NoError(t, err)
+	// Shutdown stays safe to call again
+	q.Shutdown()
+	q.Wait()
+
+	q, err = NewQueue(
+		WithWorker(failingShutdownWorker{NewRing()}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	ok, err = q.ShutdownE()
+	assert.True(t, ok)
+	assert.EqualError(t, err, "broker unreachable")
+	ok, err = q.ShutdownE()
+	assert.False(t, ok)
+	assert.NoError(t, err)
+	q.Wait()
+}
+
+func TestStartAndWait(t *testing.T) {
+	w := &lifecycleWorker{
+		Ring: NewRing(),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(2),
+		WithHandlerPool(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, q.Workers())
+
+	assert.NoError(t, q.StartAndWait(context.Background()))
+	select {
+	case <-q.started:
+	default:
+		t.Fatal("dispatcher loop not running")
+	}
+	// the configured workers are live as soon as it returns
+	assert.Equal(t, 2, q.Workers())
+	q.Release()
+	assert.Equal(t, 0, q.Workers())
+	assert.True(t, w.afterRun)
+
+	w = &lifecycleWorker{
+		Ring:      NewRing(),
+		beforeErr: errors.New("connection refused"),
+	}
+	q, err = NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.EqualError(t, q.StartAndWait(context.Background()), "connection refused")
+	q.Release()
+}
+
+func TestPollInterval(t *testing.T) {
+	pickup := func(interval time.Duration) time.Duration {
+		q, err := NewQueue(
+			// hide the blocking request of the ring so that the queue polls
+			WithWorker(struct{ core.Worker }{NewRing()}),
+			WithWorkerCount(1),
+			WithPollInterval(interval),
+			WithLogger(NewEmptyLogger()),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, q.Start())
+		defer q.Release()
+
+		// let the idle worker start waiting on an empty queue
+		time.Sleep(20 * time.Millisecond)
+
+		done := make(chan struct{})
+		start := time.Now()
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			close(done)
+			return nil
+		}))
+		<-done
+		return time.Since(start)
+	}
+
+	fast := pickup(10 * time.Millisecond)
+	slow := pickup(500 * time.Millisecond)
+	assert.Less(t, fast, 100*time.Millisecond)
+	assert.Greater(t, slow, fast)
+}
+
+// singleRequestWorker hides the batch support of the wrapped worker and
+// counts Request round-trips.
+type singleRequestWorker struct {
+	core.Worker
+	calls int32
+}
+
+func (w *singleRequestWorker) Request() (core.TaskMessage, error) {
+	atomic.AddInt32(&w.calls, 1)
+	return w.Worker.Request()
+}
+
+// batchRequestWorker counts RequestBatch round-trips.
+type batchRequestWorker struct {
+	*Ring
+	calls int32
+}
+
+func (w *batchRequestWorker) RequestBatch(n int) ([]core.TaskMessage, error) {
+	atomic.AddInt32(&w.calls, 1)
+	return w.Ring.RequestBatch(n)
+}
+
+// finishWorker hands out copies of the messages of the wrapped worker, as a
+// remote backend decoding them does, and records their outcome.
+type finishWorker struct {
+	core.Worker
+	mu       sync.Mutex
+	finished map[string][]error
+}
+
+func newFinishWorker(w core.Worker) *finishWorker {
+	return &finishWorker{Worker: w, finished: make(map[string][]error)}
+}
+
+func (w *finishWorker) Request() (core.TaskMessage, error) {
+	task, err := w.Worker.Request()
+	if m, ok := task.(*job.Message); ok {
+		return copyMessage(m), err
+	}
+	return task, err
+}
+
+func (w *finishWorker) Finish(task core.TaskMessage, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.finished[string(task.Payload())] = append(w.finished[string(task.Payload())], err)
+}
+
+func (w *finishWorker) outcomes(payload string) []error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.finished[payload]
+}
+
+func TestFinisher(t *testing.T) {
+	errFailed := errors.New("failed")
+	fn := WithFn(func(ctx context.Context, m core.TaskMessage) error {
+		if string(m.Payload()) == "fail" {
+			return errFailed
+		}
+		return nil
+	})
+
+	t.Run("outcome", func(t *testing.T) {
+		w := newFinishWorker(NewRing(fn))
+		q, err := NewQueue(WithWorker(w), WithLogger(NewEmptyLogger()))
+		assert.NoError(t, err)
+
+		assert.NoError(t, q.Queue(mockMessage{message: "ok"}))
+		assert.NoError(t, q.Queue(mockMessage{message: "fail"}))
+		assert.NoError(t, q.Queue(mockMessage{message: "old"}, job.AllowOption{MaxAge: job.Time(time.Nanosecond)}))
+		time.Sleep(time.Millisecond)
+		q.Start()
+		q.Release()
+
+		assert.Equal(t, []error{nil}, w.outcomes("ok"))
+		assert.Equal(t, []error{errFailed}, w.outcomes("fail"))
+		// expired jobs are settled
+		assert.Equal(t, []error{nil}, w.outcomes("old"))
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		w := newFinishWorker(NewRing(fn))
+		q, err := NewQueue(
+			WithWorker(w),
+			WithDeadLetter(func(core.TaskMessage, error) {}),
+			WithLogger(NewEmptyLogger()),
+		)
+		assert.NoError(t, err)
+
+		assert.NoError(t, q.Queue(mockMessage{message: "fail"}))
+		q.Start()
+		q.Release()
+
+		assert.Equal(t, []error{nil}, w.outcomes("fail"))
+	})
+
+	t.Run("requeue", func(t *testing.T) {
+		w := newFinishWorker(NewRing(fn))
+		q, err := NewQueue(
+			WithWorker(w),
+			WithRequeueOnFailure(0, 1),
+			WithPollInterval(time.Millisecond),
+			WithLogger(NewEmptyLogger()),
+		)
+		assert.NoError(t, err)
+
+		assert.NoError(t, q.Queue(mockMessage{message: "fail"}))
+		q.Start()
+		assert.Eventually(t, func() bool {
+			return q.FailureTasks() == 1
+		}, time.Second, 5*time.Millisecond)
+		q.Release()
+
+		// the first delivery is settled as it is queued again
+		assert.Equal(t, []error{nil, errFailed}, w.outcomes("fail"))
+	})
+
+	t.Run("dequeue", func(t *testing.T) {
+		w := newFinishWorker(NewRing(fn))
+		q, err := NewQueue(WithWorker(w), WithLogger(NewEmptyLogger()))
+		assert.NoError(t, err)
+
+		assert.NoError(t, q.Queue(mockMessage{message: "ok"}))
+		_, err = q.Dequeue(context.Background())
+		assert.NoError(t, err)
+		q.Release()
+
+		assert.Equal(t, []error{nil}, w.outcomes("ok"))
+	})
+}
+
+func TestBatchRequest(t *testing.T) {
+	const total = 10
+
+	// run queues total blocking tasks and returns the round-trips needed
+	// until every one of them has started
+	run := func(w core.Worker, calls *int32) int32 {
+		q, err := NewQueue(
+			WithWorker(w),
+			WithWorkerCount(total),
+			WithLogger(NewEmptyLogger()),
+		)
+		assert.NoError(t, err)
+
+		var started sync.WaitGroup
+		started.Add(total)
+		release := make(chan struct{})
+		for i := 0; i < total; i++ {
+			assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+				started.Done()
+				<-release
+				return nil
+			}))
+		}
+		assert.NoError(t, q.Start())
+		started.Wait()
+		n := atomic.LoadInt32(calls)
+		close(release)
+		q.Release()
+		assert.Equal(t, uint64(total), q.SuccessTasks())
+		return n
+	}
+
+	single := &singleRequestWorker{Worker: NewRing()}
+	batch := &batchRequestWorker{Ring: NewRing()}
+
+	assert.GreaterOrEqual(t, run(single, &single.calls), int32(total))
+	assert.Equal(t, int32(1), run(batch, &batch.calls))
+}
+
+func TestUpdateWorkerCountDecrease(t *testing.T) {
+	total := 40
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(4),
+		WithPollInterval(10*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+
+	assert.Eventually(t, func() bool {
+		return q.Workers() == 4
+	}, time.Second, time.Millisecond)
+
+	// the surplus workers exit once their job is done
+	q.UpdateWorkerCount(1)
+	assert.Eventually(t, func() bool {
+		return q.Workers() == 1
+	}, time.Second, time.Millisecond)
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, 1, q.Workers())
+		assert.LessOrEqual(t, q.BusyWorkers(), int64(1))
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Less(t, int(q.SuccessTasks()), total)
+
+	q.UpdateWorkerCount(4)
+	assert.Equal(t, 4, q.Workers())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == uint64(total)
+	}, 2*time.Second, 5*time.Millisecond)
+	q.Release()
+	assert.Equal(t, 0, q.Workers())
+}
+
+func TestRetireOneWorker(t *testing.T) {
+	total := 6
+	release := make(chan struct{})
+	var running int32
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(3),
+		WithPollInterval(10*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			atomic.AddInt32(&running, 1)
+			<-release
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&running) == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 3, q.Workers())
+
+	for live := 2; live >= 1; live-- {
+		assert.True(t, q.RetireOneWorker())
+		// the retired worker completes its job first
+		assert.Equal(t, live+1, q.Workers())
+		release <- struct{}{}
+		assert.Eventually(t, func() bool {
+			return q.Workers() == live
+		}, time.Second, time.Millisecond)
+		time.Sleep(30 * time.Millisecond)
+		assert.Equal(t, live, q.Workers())
+	}
+	assert.Equal(t, uint64(2), q.SuccessTasks())
+
+	// the last worker processes the rest
+	close(release)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == uint64(total)
+	}, time.Second, time.Millisecond)
+	assert.True(t, q.RetireOneWorker())
+	assert.False(t, q.RetireOneWorker())
+	assert.Equal(t, 0, q.Workers())
+	q.Release()
+}
+
+func TestRetireOneWorkerCPUScaling(t *testing.T) {
+	defer func(fn func() int) { numCPU = fn }(numCPU)
+	numCPU = func() int { return 2 }
+
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(3),
+		WithCPUScaling(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.StartAndWait(context.Background()))
+	assert.Equal(t, 2, q.Workers())
+
+	// every retirement stops a live worker
+	assert.True(t, q.RetireOneWorker())
+	assert.Equal(t, 1, q.Workers())
+	assert.True(t, q.RetireOneWorker())
+	assert.Equal(t, 0, q.Workers())
+	assert.False(t, q.RetireOneWorker())
+	q.Release()
+}
+
+func TestSaturation(t *testing.T) {
+	release := make(chan struct{})
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(4),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, q.Saturation())
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			<-release
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.Saturation() == 0.75
+	}, time.Second, time.Millisecond)
+
+	q.UpdateWorkerCount(6)
+	assert.Equal(t, 0.5, q.Saturation())
+
+	// more running jobs than workers left
+	q.UpdateWorkerCount(2)
+	assert.Equal(t, 1.0, q.Saturation())
+	q.UpdateWorkerCount(0)
+	assert.Equal(t, 0.0, q.Saturation())
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return q.BusyWorkers() == 0
+	}, time.Second, time.Millisecond)
+	q.UpdateWorkerCount(4)
+	assert.Equal(t, 0.0, q.Saturation())
+	q.Release()
+}
+
+// pollClock records the waits shorter than a minute, the polls of the
+// queue, leaving out the job deadlines.
+type pollClock struct {
+	*fakeClock
+	mu    sync.Mutex
+	polls []time.Duration
+}
+
+func (c *pollClock) After(d time.Duration) <-chan time.Time {
+	if d < time.Minute {
+		c.mu.Lock()
+		c.polls = append(c.polls, d)
+		c.mu.Unlock()
+	}
+	return c.fakeClock.After(d)
+}
+
+func (c *pollClock) Polls() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.polls...)
+}
+
+func TestIdleBackoff(t *testing.T) {
+	clock := &pollClock{fakeClock: newFakeClock()}
+	w := queuetest.NewFakeWorker()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithClock(clock),
+		WithIdleBackoff(10*time.Millisecond, 80*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	// wait for the n-th poll and let it elapse
+	advance := func(n int) {
+		assert.Eventually(t, func() bool {
+			return len(clock.Polls()) >= n
+		}, time.Second, time.Millisecond)
+		clock.Advance(clock.Polls()[n-1])
+	}
+
+	// the wait grows while the worker stays empty
+	for n := 1; n <= 5; n++ {
+		advance(n)
+	}
+	assert.Eventually(t, func() bool {
+		return len(clock.Polls()) == 6
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		80 * time.Millisecond,
+		80 * time.Millisecond,
+		80 * time.Millisecond,
+	}, clock.Polls())
+
+	// and starts over once a task arrives
+	assert.NoError(t, q.QueueTask(func(context.Context) error {
+		return nil
+	}))
+	advance(6)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1 && len(clock.Polls()) >= 7
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, clock.Polls()[6])
+	q.Release()
+}
+
+func TestUpdateWorkerCountToZero(t *testing.T) {
+	total := 20
+	var started int32
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithPollInterval(10*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			atomic.AddInt32(&started, 1)
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&started) >= 2
+	}, time.Second, time.Millisecond)
+
+	// in-flight jobs finish, no new ones start
+	q.UpdateWorkerCount(0)
+	assert.Eventually(t, func() bool {
+		return q.BusyWorkers() == 0
+	}, time.Second, time.Millisecond)
+	paused := atomic.LoadInt32(&started)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, paused, atomic.LoadInt32(&started))
+	assert.Less(t, int(paused), total)
+
+	// raising the count resumes processing
+	q.UpdateWorkerCount(2)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == uint64(total)
+	}, 2*time.Second, 5*time.Millisecond)
+	q.Release()
+}
+
+func TestQueueTaskAndWaitCancelsRunningTask(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err := q.QueueTaskAndWait(ctx, func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			stopped <- ctx.Err()
+			return ctx.Err()
+		case <-time.After(time.Second):
+			stopped <- nil
+			return nil
+		}
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, <-stopped)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestQueueTaskAndWaitSkipsCanceledTask(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	release := make(chan struct{})
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		<-release
+		return nil
+	}))
+
+	var ran int32
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := q.QueueTaskAndWait(ctx, func(ctx context.Context) error {
+		atomic.StoreInt32(&ran, 1)
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks()+q.FailureTasks() == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ran))
+}
+
+// captureLogger records the debug messages.
+type captureLogger struct {
+	emptyLogger
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) Debugf(format string, args ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func TestDebugLifecycle(t *testing.T) {
+	l := &captureLogger{}
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(l),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}, job.AllowOption{ID: job.String("job-1")}))
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	assert.Len(t, l.lines, 4)
+	assert.Equal(t, `job "job-1" enqueued`, l.lines[0])
+	assert.Equal(t, `job "job-1" requested`, l.lines[1])
+	assert.Equal(t, `job "job-1" started on worker 0`, l.lines[2])
+	assert.Contains(t, l.lines[3], `job "job-1" finished on worker 0: succeeded in `)
+}
+
+// plainLogger hides the debug methods of the wrapped logger.
+type plainLogger struct {
+	Logger
+}
+
+func TestLoggerWithoutDebug(t *testing.T) {
+	var l Logger = plainLogger{NewEmptyLogger()}
+	_, ok := l.(DebugLogger)
+	assert.False(t, ok)
+
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(l),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}, job.AllowOption{ID: job.String("job-1")}))
+	assert.NoError(t, q.Start())
+	q.Release()
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+}
+
+func TestMaxInFlight(t *testing.T) {
+	total := 20
+	var running, maxRunning int32
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(10),
+		WithMaxInFlight(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == uint64(total)
+	}, 2*time.Second, 5*time.Millisecond)
+	q.Release()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxRunning))
+}
+
+func TestShutdownDrain(t *testing.T) {
+	total := 6
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithShutdownMode(ShutdownDrain),
+		WithPollInterval(10*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(30 * time.Millisecond):
+				return nil
+			}
+		}))
+	}
+	q.Release()
+
+	assert.Equal(t, uint64(total), q.SuccessTasks())
+	assert.Equal(t, uint64(0), q.FailureTasks())
+	assert.Equal(t, ErrQueueShutdown, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+}
+
+func TestTaskTimeoutError(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	err := q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, job.AllowOption{
+		ID:      job.String("slow"),
+		Timeout: job.Time(20 * time.Millisecond),
+	})
+
+	var timeoutErr *job.TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, "slow", timeoutErr.ID)
+	assert.GreaterOrEqual(t, timeoutErr.Elapsed, 20*time.Millisecond)
+	assert.ErrorIs(t, err, job.ErrTaskTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// blockingWorker only hands out tasks through RequestWithContext and
+// records why its last request returned.
+type blockingWorker struct {
+	*Ring
+	err chan error
+}
+
+func (w *blockingWorker) RequestWithContext(ctx context.Context) (core.TaskMessage, error) {
+	<-ctx.Done()
+	w.err <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func TestRequestWithContextCancelledOnShutdown(t *testing.T) {
+	w := &blockingWorker{
+		Ring: NewRing(),
+		err:  make(chan error, 1),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	q.Release()
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, context.Canceled, <-w.err)
+}
+
+func TestRequestWithContextPickup(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+	defer q.Release()
+
+	// the idle worker blocks on the ring instead of polling every second
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	assert.NoError(t, q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+		return nil
+	}))
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestCancelPendingJob(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	release := make(chan struct{})
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		<-release
+		return nil
+	}))
+
+	var ran int32
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+			atomic.StoreInt32(&ran, 1)
+			return nil
+		}, job.AllowOption{ID: job.String("pending")})
+	}()
+	assert.Eventually(t, func() bool {
+		status, ok := q.Status("pending")
+		return ok && status == JobPending
+	}, time.Second, time.Millisecond)
+
+	assert.True(t, q.Cancel("pending"))
+	assert.Equal(t, context.Canceled, <-waitErr)
+	assert.False(t, q.Cancel("pending"))
+	_, ok := q.Status("pending")
+	assert.False(t, ok)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ran))
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return ctx.Err()
+	}, job.AllowOption{ID: job.String("running")}))
+
+	<-started
+	assert.True(t, q.Cancel("running"))
+	assert.Equal(t, context.Canceled, <-stopped)
+	assert.False(t, q.Cancel("unknown"))
+}
+
+// remoteWorker is a ring pretending to hand its tasks to another process.
+type remoteWorker struct {
+	*Ring
+}
+
+func (remoteWorker) Local() bool {
+	return false
+}
+
+func TestTaskNotSerializable(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(remoteWorker{NewRing()}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ErrTaskNotSerializable, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+
+	// a composite worker is only local when all its workers are
+	q, err = NewQueue(
+		WithWorker(NewMultiWorker(NewRing(), remoteWorker{NewRing()})),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrTaskNotSerializable, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+}
+
+func TestSlowHandlerDoesNotBlockDispatch(t *testing.T) {
+	total := 200
+	workers := 4
+	var running, maxRunning int32
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(int64(workers)),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		slow := i%10 == 0
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			if slow {
+				time.Sleep(20 * time.Millisecond)
+			}
+			atomic.AddInt32(&running, -1)
+			return nil
+		}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == uint64(total)
+	}, 5*time.Second, 5*time.Millisecond)
+	q.Release()
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(workers))
+}
+
+func TestLen(t *testing.T) {
+	w := NewRing()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, q.Len())
+	assert.True(t, q.IsEmpty())
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	assert.NoError(t, q.Queue(mockMessage{message: "bar"}))
+	assert.Equal(t, 2, q.Len())
+	assert.False(t, q.IsEmpty())
+
+	_, err = w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, q.Len())
+	_, err = w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, q.Len())
+	assert.True(t, q.IsEmpty())
+
+	// the length of a worker without Usage is unknown
+	q, err = NewQueue(
+		WithWorker(struct{ core.Worker }{NewRing()}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, -1, q.Len())
+	assert.False(t, q.IsEmpty())
+}
+
+func TestDecodeErrorPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       DecodeErrorPolicy
+		failures     uint64
+		dropped      uint64
+		deadLettered uint64
+	}{
+		{name: "fail", policy: DecodeFail, failures: 1},
+		{name: "drop", policy: DecodeDrop, dropped: 1},
+		{name: "dead letter", policy: DecodeDeadLetter, failures: 1, deadLettered: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payloads []string
+			var deadLetters []string
+			w := NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+				payloads = append(payloads, string(m.Payload()))
+				return nil
+			}))
+			q, err := NewQueue(
+				WithWorker(w),
+				WithWorkerCount(1),
+				WithDecodeErrorPolicy(tt.policy),
+				WithDeadLetter(func(task core.TaskMessage, err error) {
+					assert.ErrorIs(t, err, ErrDecodeMessage)
+					deadLetters = append(deadLetters, string(task.Bytes()))
+				}),
+				WithLogger(NewEmptyLogger()),
+			)
+			assert.NoError(t, err)
+
+			// raw messages as a remote worker hands them out
+			valid := job.NewMessage(mockMessage{message: "foo"})
+			assert.NoError(t, w.Queue(mockMessage{message: string(valid.Bytes())}))
+			assert.NoError(t, w.Queue(mockMessage{message: "{corrupt"}))
+			assert.NoError(t, q.Start())
+			q.Release()
+
+			assert.Equal(t, []string{"foo"}, payloads)
+			assert.Equal(t, uint64(1), q.SuccessTasks())
+			assert.Equal(t, tt.failures, q.FailureTasks())
+			assert.Equal(t, tt.dropped, q.DroppedTasks())
+			assert.Equal(t, tt.deadLettered, q.DeadLetteredTasks())
+			if tt.deadLettered > 0 {
+				assert.Equal(t, []string{"{corrupt"}, deadLetters)
+			} else {
+				assert.Empty(t, deadLetters)
+			}
+		})
+	}
+}
+
+func TestQueueRaw(t *testing.T) {
+	var payloads []string
+	var deadLetters [][]byte
+	fail := true
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			payloads = append(payloads, string(m.Payload()))
+			if fail {
+				return errors.New("downstream unavailable")
+			}
+			return nil
+		}))),
+		WithWorkerCount(1),
+		WithDeadLetter(func(task core.TaskMessage, err error) {
+			deadLetters = append(deadLetters, task.Bytes())
+		}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}, job.AllowOption{ID: job.String("job-1")}))
+	assert.Eventually(t, func() bool {
+		return q.DeadLetteredTasks() == 1
+	}, time.Second, time.Millisecond)
+
+	// send the dead letter back as is, the payload is not wrapped again
+	fail = false
+	assert.NoError(t, q.QueueRaw(deadLetters[0]))
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	status, ok := q.Status("job-1")
+	assert.True(t, ok)
+	assert.Equal(t, JobSucceeded, status)
+	q.Release()
+
+	assert.Equal(t, []string{"foo", "foo"}, payloads)
+	assert.ErrorIs(t, q.QueueRaw([]byte("foo")), ErrDecodeMessage)
+}
+
+func TestWaitContext(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}))
+	<-started
+	q.Shutdown()
+
+	// the job is still running
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.WaitContext(ctx))
+
+	close(release)
+	assert.NoError(t, q.WaitContext(context.Background()))
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+}
+
+func TestBurstReachesFullParallelism(t *testing.T) {
+	workers := 64
+	var running, peak int32
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(int64(workers)),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	for round := 0; round < 3; round++ {
+		ready := make(chan struct{})
+		var started int32
+		for i := 0; i < workers; i++ {
+			assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				if atomic.AddInt32(&started, 1) == int32(workers) {
+					close(ready)
+				}
+				// every job waits for all the others of the burst to start,
+				// which only happens if they run in parallel
+				select {
+				case <-ready:
+					return nil
+				case <-time.After(2 * time.Second):
+					return errors.New("burst was serialized")
+				}
+			}))
+		}
+		assert.Eventually(t, func() bool {
+			return q.CompletedTasks() == uint64((round+1)*workers)
+		}, 5*time.Second, time.Millisecond)
+	}
+	q.Release()
+
+	assert.Equal(t, uint64(3*workers), q.SuccessTasks())
+	assert.Equal(t, int32(workers), atomic.LoadInt32(&peak))
+}
+
+// streamedMessage generates its payload as it is read and never holds it.
+type streamedMessage struct {
+	size int
+}
+
+func (m streamedMessage) Bytes() []byte {
+	panic("streamed payload materialized")
+}
+
+func (m streamedMessage) Reader() io.Reader {
+	return io.LimitReader(patternReader{}, int64(m.size))
+}
+
+type patternReader struct{}
+
+func (patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+func TestStreamedMessage(t *testing.T) {
+	size := 64 << 20
+	var read, chunks int
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			assert.Nil(t, m.Payload())
+			r := m.(core.StreamedMessage).Reader()
+			buf := make([]byte, 32<<10)
+			for {
+				n, err := r.Read(buf)
+				read += n
+				chunks++
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}))),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Queue(streamedMessage{size: size}))
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+	assert.Equal(t, size, read)
+	assert.Greater(t, chunks, size/(32<<10))
+}
+
+func TestStreamedMessageRemoteWorker(t *testing.T) {
+	var payload []byte
+	q, err := NewQueue(
+		WithWorker(remoteWorker{NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			payload = m.Payload()
+			return nil
+		}))}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	// a remote worker gets the whole payload
+	assert.NoError(t, q.Queue(streamedMessage{size: 4}))
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, []byte("xxxx"), payload)
+}
+
+func TestNilMessageAndTask(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+	defer q.Release()
+
+	assert.Equal(t, ErrNilMessage, q.Queue(nil))
+	assert.Equal(t, ErrNilTask, q.QueueTask(nil))
+	assert.Equal(t, ErrNilTask, q.QueueTaskAndWait(context.Background(), nil))
+	result, err := q.QueueTaskWithResult(nil)
+	assert.Nil(t, result)
+	assert.Equal(t, ErrNilTask, err)
+	errs := q.QueueBatchAndWait(context.Background(), []job.TaskFunc{
+		nil,
+		func(ctx context.Context) error {
+			return nil
+		},
+	})
+	assert.Equal(t, []error{ErrNilTask, nil}, errs)
+
+	// only the valid task was queued
+	assert.Equal(t, uint64(1), q.SubmittedTasks())
+}
+
+func TestMaxPayloadSize(t *testing.T) {
+	var payloads []string
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			payloads = append(payloads, string(m.Payload()))
+			return nil
+		}))),
+		WithWorkerCount(1),
+		WithMaxPayloadSize(4),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Queue(mockMessage{message: "1234"}))
+	assert.Equal(t, ErrPayloadTooLarge, q.Queue(mockMessage{message: "12345"}))
+
+	atLimit := job.NewMessage(mockMessage{message: "abcd"})
+	assert.NoError(t, q.QueueRaw(atLimit.Bytes()))
+	overLimit := job.NewMessage(mockMessage{message: "abcde"})
+	assert.Equal(t, ErrPayloadTooLarge, q.QueueRaw(overLimit.Bytes()))
+
+	// task functions carry no payload
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+
+	assert.Equal(t, 0, len(payloads))
+	assert.Equal(t, 3, q.Len())
+	assert.NoError(t, q.Start())
+	q.Release()
+	assert.Equal(t, []string{"1234", "abcd"}, payloads)
+}
+
+func TestDeadLetterOnShutdown(t *testing.T) {
+	var payloads []string
+	var reasons []error
+	started := make(chan struct{})
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}))),
+		WithWorkerCount(1),
+		WithDeadLetter(func(task core.TaskMessage, err error) {
+			payloads = append(payloads, string(task.Payload()))
+			reasons = append(reasons, err)
+		}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	assert.NoError(t, q.Queue(mockMessage{message: "long job"}))
+	<-started
+	q.Release()
+
+	assert.Equal(t, []string{"long job"}, payloads)
+	assert.Len(t, reasons, 1)
+	assert.ErrorIs(t, reasons[0], ErrCancelledOnShutdown)
+	assert.ErrorIs(t, reasons[0], context.Canceled)
+	assert.Equal(t, uint64(1), q.DeadLetteredTasks())
+	assert.Equal(t, uint64(1), q.FailureTasks())
+}
+
+func TestQueueTo(t *testing.T) {
+	var handled [2]int32
+	rings := make([]*Ring, 0, len(handled))
+	for i := range handled {
+		i := i
+		rings = append(rings, NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			atomic.AddInt32(&handled[i], 1)
+			return nil
+		})))
+	}
+
+	q, err := NewQueue(
+		WithWorker(NewMultiWorker(rings[0], rings[1])),
+		WithWorkerCount(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, q.QueueTo(rings[1], mockMessage{message: "foo"}))
+	}
+	assert.Equal(t, 0, rings[0].Usage())
+	assert.Equal(t, 3, rings[1].Usage())
+
+	// only the workers of the queue are accepted
+	assert.Equal(t, ErrUnknownWorker, q.QueueTo(NewRing(), mockMessage{message: "foo"}))
+	assert.Equal(t, ErrUnknownWorker, q.QueueTo(nil, mockMessage{message: "foo"}))
+	assert.Equal(t, ErrNilMessage, q.QueueTo(rings[1], nil))
+
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 3
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&handled[0]))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&handled[1]))
+}
+
+func TestQueueToSingleWorker(t *testing.T) {
+	w := NewRing()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTo(w, mockMessage{message: "foo"}))
+	assert.Equal(t, 1, w.Usage())
+	assert.Equal(t, ErrUnknownWorker, q.QueueTo(NewRing(), mockMessage{message: "foo"}))
+
+	task, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(task.Payload()))
+	q.Release()
+}
+
+func TestRequeueOnFailure(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	failed := false
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, string(m.Payload()))
+			if string(m.Payload()) == "a" && !failed {
+				failed = true
+				return errors.New("downstream unavailable")
+			}
+			return nil
+		}))),
+		WithWorkerCount(1),
+		WithRequeueOnFailure(0, 1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for _, body := range []string{"a", "b", "c"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 3
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	// the failed job waits for its turn behind the others
+	assert.Equal(t, []string{"a", "b", "c", "a"}, order)
+	assert.Equal(t, uint64(0), q.FailureTasks())
+	assert.Equal(t, uint64(1), q.RetriedTasks())
+}
+
+// queueCountingRing counts the tasks submitted to the ring.
+type queueCountingRing struct {
+	*Ring
+	queued int32
+}
+
+func (w *queueCountingRing) Queue(task core.TaskMessage) error {
+	atomic.AddInt32(&w.queued, 1)
+	return w.Ring.Queue(task)
+}
+
+func TestRetryModeRequeue(t *testing.T) {
+	var mu sync.Mutex
+	var counts []int64
+	w := &queueCountingRing{Ring: NewRing(WithFn(func(ctx context.Context, task core.TaskMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		counts = append(counts, task.(*job.Message).RetryCount)
+		if len(counts) <= 2 {
+			return errors.New("downstream unavailable")
+		}
+		return nil
+	}))}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithRetryMode(RetryRequeue),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}, job.AllowOption{
+		RetryCount: job.Int64(3),
+		RetryDelay: job.Time(5 * time.Millisecond),
+	}))
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	// each retry went through the queue with one retry less
+	assert.Equal(t, []int64{3, 2, 1}, counts)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&w.queued))
+	assert.Equal(t, uint64(2), q.RetriedTasks())
+	assert.Equal(t, uint64(0), q.FailureTasks())
+}
+
+func TestRetryModeRequeueAttempts(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []string
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, task core.TaskMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, fmt.Sprintf("%d/%d", job.Attempt(ctx), job.MaxAttempts(ctx)))
+			return errors.New("downstream unavailable")
+		}))),
+		WithWorkerCount(1),
+		WithRetryMode(RetryRequeue),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}, job.AllowOption{
+		RetryCount: job.Int64(2),
+		RetryDelay: job.Time(time.Millisecond),
+	}))
+	assert.Eventually(t, func() bool {
+		return q.FailureTasks() == 1
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	// the attempts carry on across the requeues
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"1/3", "2/3", "3/3"}, attempts)
+	e := <-q.Events()
+	assert.Equal(t, JobFailed, e.Outcome)
+	assert.Equal(t, 3, e.Attempt)
+}
+
+func TestRetryModeRequeueGivesUp(t *testing.T) {
+	var runs int32
+	w := &queueCountingRing{Ring: NewRing()}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithRetryMode(RetryRequeue),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	errFailed := errors.New("failed")
+	done := make(chan error, 1)
+	go func() {
+		done <- q.QueueTaskAndWait(context.Background(), func(context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return errFailed
+		}, job.AllowOption{
+			RetryCount: job.Int64(2),
+			RetryDelay: job.Time(time.Millisecond),
+		})
+	}()
+	assert.NoError(t, q.Start())
+
+	// the waiter only hears about the last attempt
+	assert.ErrorIs(t, <-done, errFailed)
+	q.Release()
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&runs))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&w.queued))
+	assert.Equal(t, uint64(2), q.RetriedTasks())
+	assert.Equal(t, uint64(1), q.FailureTasks())
+}
+
+func TestRequeueOnFailureGivesUp(t *testing.T) {
+	var runs int32
+	var deadLetters []error
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithRequeueOnFailure(time.Millisecond, 2),
+		WithDeadLetter(func(task core.TaskMessage, err error) {
+			deadLetters = append(deadLetters, err)
+		}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	err = q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("downstream unavailable")
+	}, job.AllowOption{ID: job.String("job-1")})
+	assert.EqualError(t, err, "downstream unavailable")
+	q.Release()
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&runs))
+	assert.Equal(t, uint64(1), q.FailureTasks())
+	assert.Len(t, deadLetters, 1)
+	status, ok := q.Status("job-1")
+	assert.True(t, ok)
+	assert.Equal(t, JobFailed, status)
+}
+
+func TestQueueDuringShutdown(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			return nil
+		}))),
+		WithWorkerCount(4),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	var accepted int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := q.Queue(mockMessage{message: "foo"})
+				if err == ErrQueueShutdown {
+					return
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				atomic.AddInt64(&accepted, 1)
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	q.Release()
+	wg.Wait()
+
+	// every accepted job was handled before the worker shut down
+	assert.Equal(t, uint64(atomic.LoadInt64(&accepted)), q.SuccessTasks())
+}
+
+func TestUnprocessed(t *testing.T) {
+	w := queuetest.NewFakeWorker()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	for _, body := range []string{"a", "b", "c"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+	assert.Equal(t, 0, q.Unprocessed())
+
+	// the backlog was never requested from the worker
+	q.Release()
+	assert.Equal(t, 3, q.Unprocessed())
+	assert.Empty(t, w.Ran())
+}
+
+func TestUnprocessedRing(t *testing.T) {
+	run := func(t *testing.T, opts ...Option) *Queue {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		q, err := NewQueue(
+			WithWorker(NewRing(append(opts, WithFn(func(context.Context, core.TaskMessage) error {
+				return nil
+			}))...)),
+			WithWorkerCount(1),
+			WithLogger(NewEmptyLogger()),
+		)
+		assert.NoError(t, err)
+
+		// keep the worker busy while the backlog builds up
+		assert.NoError(t, q.QueueTask(func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}))
+		assert.NoError(t, q.Start())
+		<-started
+		for _, body := range []string{"a", "b", "c"} {
+			assert.NoError(t, q.Queue(mockMessage{message: body}))
+		}
+		assert.Equal(t, 3, q.Len())
+
+		time.AfterFunc(10*time.Millisecond, func() { close(release) })
+		q.Release()
+		return q
+	}
+
+	t.Run("handed out", func(t *testing.T) {
+		// the ring hands out its backlog before its shutdown returns
+		q := run(t)
+		assert.Equal(t, 0, q.Unprocessed())
+		assert.Equal(t, uint64(4), q.SuccessTasks())
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		q := run(t, WithPersistence(filepath.Join(t.TempDir(), "queue.db")))
+		assert.Equal(t, 3, q.Unprocessed())
+		assert.Equal(t, uint64(1), q.SuccessTasks())
+	})
+}
+
+func TestWorker(t *testing.T) {
+	w := NewRing()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	defer q.Release()
+
+	ring, ok := q.Worker().(*Ring)
+	assert.True(t, ok)
+	assert.Same(t, w, ring)
+}
+
+func TestSoftTimeout(t *testing.T) {
+	clock := newFakeClock()
+	slow := make(chan time.Duration, 1)
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithClock(clock),
+		WithSlowTaskCallback(func(task core.TaskMessage, elapsed time.Duration) {
+			slow <- elapsed
+		}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	finish := make(chan struct{})
+	m := &job.Message{
+		Timeout:     time.Hour,
+		SoftTimeout: time.Minute,
+		Task: func(ctx context.Context) error {
+			<-finish
+			return ctx.Err()
+		},
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- q.handle(context.Background(), m)
+	}()
+
+	// the job timeout and the soft timeout
+	assert.Eventually(t, func() bool {
+		return clock.Waiters() == 2
+	}, time.Second, time.Millisecond)
+	clock.Advance(30 * time.Second)
+	assert.Len(t, slow, 0)
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, time.Minute, <-slow)
+
+	// the job keeps running and completes before the hard timeout
+	close(finish)
+	assert.NoError(t, <-done)
+
+	// a job finishing in time is not reported
+	m = &job.Message{
+		Timeout:     time.Hour,
+		SoftTimeout: time.Minute,
+		Task: func(ctx context.Context) error {
+			return nil
+		},
+	}
+	assert.NoError(t, q.handle(context.Background(), m))
+	clock.Advance(time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(t, slow, 0)
+}
+
+func TestProcessN(t *testing.T) {
+	var payloads []string
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			payloads = append(payloads, string(m.Payload()))
+			if string(m.Payload()) == "c" {
+				return errors.New("downstream unavailable")
+			}
+			return nil
+		}))),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for _, body := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+
+	processed, err := q.ProcessN(context.Background(), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, processed)
+	assert.Equal(t, []string{"a", "b", "c"}, payloads)
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, uint64(2), q.SuccessTasks())
+	assert.Equal(t, uint64(1), q.FailureTasks())
+	assert.Equal(t, int64(0), q.BusyWorkers())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	processed, err = q.ProcessN(ctx, 1)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, processed)
+
+	// stops once the worker is empty
+	processed, err = q.ProcessN(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, processed)
+	assert.Equal(t, 0, q.Len())
+
+	q.Release()
+	processed, err = q.ProcessN(context.Background(), 1)
+	assert.Equal(t, ErrQueueShutdown, err)
+	assert.Equal(t, 0, processed)
+}
+
+func TestConcurrencyKeyFreesWorker(t *testing.T) {
+	release := make(chan struct{})
+	ran := make(chan string, 3)
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for _, name := range []string{"first", "second"} {
+		name := name
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			ran <- name
+			<-release
+			return nil
+		}, job.WithConcurrencyKey("user-1")))
+	}
+	assert.NoError(t, q.Start())
+	assert.Equal(t, "first", <-ran)
+
+	// the second job waits for the key without holding the other worker
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		ran <- "other"
+		return nil
+	}))
+	assert.Equal(t, "other", <-ran)
+	assert.Eventually(t, func() bool {
+		return q.BusyWorkers() == 1
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	assert.Equal(t, "second", <-ran)
+	q.Release()
+	assert.Equal(t, uint64(3), q.SuccessTasks())
+}
+
+func TestCancelParked(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, job.WithConcurrencyKey("user-1")))
+	assert.NoError(t, q.Start())
+	<-started
+	results, err := q.QueueTaskWithResult(func(ctx context.Context) (interface{}, error) {
+		return nil, nil
+	}, job.WithConcurrencyKey("user-1"), job.AllowOption{ID: job.String("parked")})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		q.limits.Lock()
+		defer q.limits.Unlock()
+		return len(q.limits.parked) == 1
+	}, time.Second, time.Millisecond)
+
+	// the parked job never runs
+	assert.True(t, q.Cancel("parked"))
+	assert.ErrorIs(t, (<-results).Err, context.Canceled)
+	close(release)
+	q.Release()
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+}
+
+func TestClassConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running := map[string]int{}
+	peak := map[string]int{}
+	release := make(chan struct{})
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(6),
+		WithClassConcurrency(map[string]int{"slow": 1, "fast": 2}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	track := func(class string) job.TaskFunc {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			running[class]++
+			if running[class] > peak[class] {
+				peak[class] = running[class]
+			}
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			running[class]--
+			mu.Unlock()
+			return nil
+		}
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, q.QueueTask(track("slow"), job.WithClass("slow")))
+		assert.NoError(t, q.QueueTask(track("fast"), job.WithClass("fast")))
+	}
+	assert.NoError(t, q.Start())
+
+	// each class fills up to its own limit
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running["slow"] == 1 && running["fast"] == 2
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	// the jobs over their class limit don't hold a worker
+	assert.Equal(t, int64(3), q.BusyWorkers())
+	close(release)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 6
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	assert.Equal(t, map[string]int{"slow": 1, "fast": 2}, peak)
+}
+
+// infoLogger records the info messages.
+type infoLogger struct {
+	emptyLogger
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *infoLogger) Info(args ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprint(args...))
+	l.mu.Unlock()
+}
+
+func TestResultSummarizer(t *testing.T) {
+	l := &infoLogger{}
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			if string(m.Payload()) == "order-2" {
+				return errors.New("out of stock")
+			}
+			return nil
+		}))),
+		WithWorkerCount(1),
+		WithResultSummarizer(func(msg core.QueuedMessage, err error) string {
+			m := msg.(*job.Message)
+			if err != nil {
+				return fmt.Sprintf("%s failed: %s", m.Body, err)
+			}
+			if string(m.Body) == "order-3" {
+				return ""
+			}
+			return fmt.Sprintf("%s done", m.Body)
+		}),
+		WithLogger(l),
+	)
+	assert.NoError(t, err)
+
+	for _, body := range []string{"order-1", "order-2", "order-3"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks()+q.FailureTasks() == 3
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	assert.Equal(t, []string{"order-1 done", "order-2 failed: out of stock"}, l.lines)
+}
+
+func TestCPUScaling(t *testing.T) {
+	defer func(fn func() int) { numCPU = fn }(numCPU)
+	numCPU = func() int { return 2 }
+
+	release := make(chan struct{})
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(10),
+		WithCPUScaling(1.5),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			<-release
+			return nil
+		}))
+	}
+	assert.NoError(t, q.StartAndWait(context.Background()))
+	assert.Equal(t, 3, q.Workers())
+	assert.Eventually(t, func() bool {
+		return q.BusyWorkers() == 3
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(3), q.BusyWorkers())
+	assert.Equal(t, 3, q.Workers())
+
+	// a lower worker count is not raised by the cap
+	q.UpdateWorkerCount(2)
+	close(release)
+	assert.Eventually(t, func() bool {
+		return q.Workers() == 2
+	}, time.Second, time.Millisecond)
+	q.Release()
+	assert.Equal(t, uint64(10), q.SuccessTasks())
+
+	tests := []struct {
+		name string
+		opts []Option
+		want int
+	}{
+		{"at least one", []Option{WithCPUScaling(0.1)}, 1},
+		{"disabled", []Option{WithCPUScaling(0)}, 10},
+		{"overridden", []Option{WithCPUScaling(1), WithCPUScaling(0)}, 10},
+		{"above worker count", []Option{WithCPUScaling(8)}, 10},
+	}
+	for _, tt := range tests {
+		q, err := NewQueue(append([]Option{
+			WithWorker(NewRing()),
+			WithWorkerCount(10),
+			WithLogger(NewEmptyLogger()),
+		}, tt.opts...)...)
+		assert.NoError(t, err)
+		assert.NoError(t, q.StartAndWait(context.Background()))
+		assert.Equal(t, tt.want, q.Workers(), tt.name)
+		q.Release()
+	}
+}
+
+type delayedRequeueWorker struct {
+	*Ring
+	mu       sync.Mutex
+	err      error
+	requeued []*job.Message
+	delays   []time.Duration
+}
+
+func (w *delayedRequeueWorker) RequeueAfter(task core.TaskMessage, delay time.Duration) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	m := *task.(*job.Message)
+	w.requeued = append(w.requeued, &m)
+	w.delays = append(w.delays, delay)
+	return nil
+}
+
+func TestDelayedRequeue(t *testing.T) {
+	var runs int32
+	w := &delayedRequeueWorker{
+		Ring: NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			atomic.AddInt32(&runs, 1)
+			return errors.New("downstream unavailable")
+		})),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}, job.AllowOption{
+		ID:         job.String("job-1"),
+		RetryCount: job.Int64(2),
+		RetryDelay: job.Time(time.Hour),
+	}))
+
+	// the worker is freed at once instead of waiting an hour
+	assert.Eventually(t, func() bool {
+		return q.BusyWorkers() == 0 && q.RetriedTasks() == 1
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	assert.Len(t, w.requeued, 1)
+	assert.Equal(t, "foo", string(w.requeued[0].Payload()))
+	assert.Equal(t, int64(1), w.requeued[0].RetryCount)
+	assert.Equal(t, []time.Duration{time.Hour}, w.delays)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	// the job is not finished yet
+	assert.Equal(t, uint64(0), q.SuccessTasks())
+	assert.Equal(t, uint64(0), q.FailureTasks())
+	status, ok := q.Status("job-1")
+	assert.True(t, ok)
+	assert.Equal(t, JobPending, status)
+}
+
+// redeliveringRing delivers the delayed retries at once, encoded like a
+// broker would.
+type redeliveringRing struct {
+	*Ring
+}
+
+func (w *redeliveringRing) RequeueAfter(task core.TaskMessage, delay time.Duration) error {
+	return w.Queue(job.Decode(task.Bytes()))
+}
+
+func TestDelayedRequeueAttempts(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []string
+	w := &redeliveringRing{Ring: NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, fmt.Sprintf("%d/%d", job.Attempt(ctx), job.MaxAttempts(ctx)))
+		return errors.New("downstream unavailable")
+	}))}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}, job.AllowOption{
+		RetryCount: job.Int64(2),
+		RetryDelay: job.Time(time.Hour),
+	}))
+	assert.Eventually(t, func() bool {
+		return q.FailureTasks() == 1
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	// the attempts carry on across the deliveries
+	assert.Equal(t, []string{"1/3", "2/3", "3/3"}, attempts)
+	assert.Equal(t, uint64(2), q.RetriedTasks())
+	e := <-q.Events()
+	assert.Equal(t, JobFailed, e.Outcome)
+	assert.Equal(t, 3, e.Attempt)
+}
+
+func TestDelayedRequeueFallback(t *testing.T) {
+	var runs int32
+	w := &delayedRequeueWorker{
+		Ring: NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			if atomic.AddInt32(&runs, 1) == 1 {
+				return errors.New("downstream unavailable")
+			}
+			return nil
+		})),
+		err: errors.New("broker unreachable"),
+	}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	// the retry runs in process when the backend refuses it
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}, job.AllowOption{
+		RetryCount: job.Int64(1),
+		RetryDelay: job.Time(time.Millisecond),
+	}))
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	q.Release()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+}
+
+func TestFlush(t *testing.T) {
+	ring := NewRing()
+	release := make(chan struct{})
+	q, err := NewQueue(
+		// hide the blocking request of the ring so that the queue polls
+		WithWorker(struct {
+			core.Worker
+			core.UsageReporter
+		}{ring, ring}),
+		WithWorkerCount(5),
+		WithPollInterval(time.Hour),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	// let the idle queue wait for the next poll
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			<-release
+			return nil
+		}))
+	}
+	assert.Equal(t, 5, q.Len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, q.Flush(ctx))
+	assert.Equal(t, 0, q.Len())
+
+	// no worker is free to take the next one
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.Flush(ctx))
+	assert.Equal(t, 1, q.Len())
+
+	close(release)
+	assert.NoError(t, q.Flush(context.Background()))
+	q.Release()
+	assert.Equal(t, uint64(6), q.SuccessTasks())
+}
+
+func TestFlushClock(t *testing.T) {
+	clock := newFakeClock()
+	w := queuetest.NewFakeWorker()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithClock(clock),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+
+	// the queue isn't started, flush waits on the clock
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Flush(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		return clock.Waiters() > 0
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	q.Release()
+}
+
+func TestManualDispatch(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []string
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			mu.Lock()
+			payloads = append(payloads, string(m.Payload()))
+			mu.Unlock()
+			return nil
+		}))),
+		WithWorkerCount(2),
+		WithManualDispatch(),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.StartAndWait(context.Background()))
+
+	for _, body := range []string{"a", "b", "c"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+
+	// nothing runs until the caller ticks
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, uint64(0), q.SuccessTasks())
+
+	for i := 1; i <= 3; i++ {
+		assert.True(t, q.Tick())
+		assert.Eventually(t, func() bool {
+			return q.SuccessTasks() == uint64(i)
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, 3-i, q.Len())
+	}
+	assert.False(t, q.Tick())
+	q.Release()
+	assert.False(t, q.Tick())
+
+	assert.Equal(t, []string{"a", "b", "c"}, payloads)
+}
+
+func TestManualDispatchBusy(t *testing.T) {
+	release := make(chan struct{})
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithManualDispatch(),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			<-release
+			return nil
+		}))
+	}
+	assert.True(t, q.Tick())
+	// the only worker is busy
+	assert.False(t, q.Tick())
+	assert.Equal(t, 1, q.Len())
+
+	close(release)
+	assert.Eventually(t, q.Tick, time.Second, time.Millisecond)
+	q.Release()
+	assert.Equal(t, uint64(2), q.SuccessTasks())
+}
+
+func TestFailuresByType(t *testing.T) {
+	w := NewRing()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return errors.New("out of stock")
+	}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return errors.New("out of stock")
+	}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, job.AllowOption{Timeout: job.Time(10 * time.Millisecond)}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		panic("boom")
+	}))
+	// a raw message as a remote worker hands it out
+	assert.NoError(t, w.Queue(mockMessage{message: "{corrupt"}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, map[string]uint64{
+		FailureTask:    2,
+		FailureTimeout: 1,
+		FailurePanic:   1,
+		FailureDecode:  1,
+	}, q.FailuresByType())
+	assert.Equal(t, uint64(5), q.FailureTasks())
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+}
+
+func TestAttemptInContext(t *testing.T) {
+	var attempts [][2]int
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+	defer q.Release()
+
+	err = q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+		attempts = append(attempts, [2]int{job.Attempt(ctx), job.MaxAttempts(ctx)})
+		if job.Attempt(ctx) < job.MaxAttempts(ctx) {
+			return errors.New("try again")
+		}
+		return nil
+	}, job.AllowOption{
+		RetryCount: job.Int64(2),
+		RetryDelay: job.Time(time.Millisecond),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{1, 3}, {2, 3}, {3, 3}}, attempts)
+
+	// without retry the first attempt is the last
+	err = q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+		assert.Equal(t, 1, job.Attempt(ctx))
+		assert.Equal(t, 1, job.MaxAttempts(ctx))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestRequestContract(t *testing.T) {
+	msg := func(body string) core.TaskMessage {
+		m := job.NewMessage(mockMessage{message: body})
+		return &m
+	}
+	w := queuetest.NewFakeWorker(msg("a"))
+	w.Return(msg("b"), errors.New("partial read"))
+	w.FailRequest(ErrNoTaskInQueue)
+	w.FailRequest(errors.New("broker down"))
+	w.Push(msg("c"))
+	clock := &pollClock{fakeClock: newFakeClock()}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithClock(clock),
+		WithPollInterval(10*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	// a task comes with an error: it runs at once
+	// no task: the queue waits for the next poll
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 2 && len(clock.Polls()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 3, w.Requests())
+
+	// the request failed: the queue waits for the next poll again
+	clock.Advance(10 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return len(clock.Polls()) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 4, w.Requests())
+	assert.Equal(t, uint64(2), q.SuccessTasks())
+
+	// the next poll gets the last task, then finds the worker empty
+	clock.Advance(10 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 3 && len(clock.Polls()) == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 6, w.Requests())
+
+	q.Release()
+	var ran []string
+	for _, task := range w.Ran() {
+		ran = append(ran, string(task.Payload()))
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, ran)
+	assert.Equal(t, uint64(0), q.FailureTasks())
+}
+
+func TestRequestErrorsAreNotFailures(t *testing.T) {
+	w := queuetest.NewFakeWorker()
+	for i := 0; i < 3; i++ {
+		w.FailRequest(errors.New("broker down"))
+	}
+	w.SetRequestDelay(time.Millisecond)
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithPollInterval(time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.QueueTask(func(context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, q.Start())
+
+	// the queue keeps polling through the failed requests
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	q.Release()
+	assert.GreaterOrEqual(t, w.Requests(), 4)
+	assert.Equal(t, uint64(0), q.FailureTasks())
+}
+
+func TestDynamicTimeout(t *testing.T) {
+	var runs int32
+	q, err := NewQueue(
+		WithWorker(NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+			atomic.AddInt32(&runs, 1)
+			select {
+			case <-time.After(50 * time.Millisecond):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}))),
+		WithDynamicTimeout(func(msg core.QueuedMessage) time.Duration {
+			return time.Duration(len(msg.(core.TaskMessage).Payload())) * 10 * time.Millisecond
+		}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	// the small payload gets too little time, the large one enough
+	small := job.NewMessage(mockMessage{message: "a"})
+	err = q.run(context.Background(), &small)
+	assert.ErrorIs(t, err, job.ErrTaskTimeout)
+	assert.Equal(t, 10*time.Millisecond, small.Timeout)
+
+	large := job.NewMessage(mockMessage{message: strings.Repeat("a", 100)})
+	assert.NoError(t, q.run(context.Background(), &large))
+	assert.Equal(t, time.Second, large.Timeout)
+
+	// no payload, no time: the job doesn't run
+	empty := job.NewMessage(mockMessage{})
+	assert.ErrorIs(t, q.run(context.Background(), &empty), ErrInvalidTimeout)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+}
+
+func TestMaxAge(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	var deadLetters int32
+	w := NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, string(m.Payload()))
+		return nil
+	}))
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithDeadLetter(func(core.TaskMessage, error) {
+			atomic.AddInt32(&deadLetters, 1)
+		}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	// a message that has been waiting for two hours
+	old := job.NewMessage(mockMessage{message: "old"}, job.WithMaxAge(time.Hour))
+	old.EnqueuedAt = time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, w.Queue(&old))
+	assert.NoError(t, q.Queue(mockMessage{message: "fresh"}, job.WithMaxAge(time.Hour)))
+
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1 && q.ExpiredTasks() == 1
+	}, time.Second, time.Millisecond)
+	q.Release()
+
+	assert.Equal(t, []string{"fresh"}, ran)
+	assert.Equal(t, uint64(0), q.FailureTasks())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&deadLetters))
+}
+
+// ttlWorker records the TTL of the tasks queued with one.
+type ttlWorker struct {
+	*Ring
+	mu   sync.Mutex
+	ttls []time.Duration
+}
+
+func (w *ttlWorker) QueueWithTTL(task core.TaskMessage, ttl time.Duration) error {
+	w.mu.Lock()
+	w.ttls = append(w.ttls, ttl)
+	w.mu.Unlock()
+	return w.Ring.Queue(task)
+}
+
+func TestMaxAgeTTL(t *testing.T) {
+	w := &ttlWorker{Ring: NewRing(WithFn(func(context.Context, core.TaskMessage) error {
+		return nil
+	}))}
+	q, err := NewQueue(
+		WithWorker(w),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	// only the message with a max age is queued with a TTL
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}, job.WithMaxAge(time.Minute)))
+	assert.NoError(t, q.Queue(mockMessage{message: "bar"}))
+	assert.Equal(t, []time.Duration{time.Minute}, w.ttls)
+	assert.Equal(t, 2, q.Len())
+
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 2
+	}, time.Second, time.Millisecond)
+	q.Release()
+}
+
+func TestMaxAgeWaiter(t *testing.T) {
+	clock := newFakeClock()
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithClock(clock),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- q.QueueTaskAndWait(context.Background(), func(context.Context) error {
+			return nil
+		}, job.WithMaxAge(time.Minute))
+	}()
+	assert.Eventually(t, func() bool {
+		return q.Len() == 1
+	}, time.Second, time.Millisecond)
+
+	// the job outlives its max age before the queue starts
+	clock.Advance(2 * time.Minute)
+	assert.NoError(t, q.Start())
+	assert.ErrorIs(t, <-done, ErrJobExpired)
+	q.Release()
+	assert.Equal(t, uint64(1), q.ExpiredTasks())
+}
+
+func TestDequeue(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	for _, body := range []string{"a", "b", "c"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}, job.AllowOption{ID: job.String(body)}))
+	}
+
+	for _, want := range []string{"a", "b", "c"} {
+		m, err := q.Dequeue(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(m.(core.TaskMessage).Payload()))
+		// the job is no longer tracked
+		_, ok := q.Status(want)
+		assert.False(t, ok)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	m, err := q.Dequeue(ctx)
+	assert.Nil(t, m)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// a waiting caller learns about the shutdown
+	done := make(chan error, 1)
+	go func() {
+		_, err := q.Dequeue(context.Background())
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	q.Release()
+	assert.Equal(t, ErrQueueShutdown, <-done)
+	assert.Equal(t, uint64(0), q.SuccessTasks())
+}
+
+func TestDequeuePolling(t *testing.T) {
+	w := queuetest.NewFakeWorker()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithPollInterval(5*time.Millisecond),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		m := job.NewMessage(mockMessage{message: "foo"})
+		w.Push(&m)
+	}()
+	m, err := q.Dequeue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(m.(core.TaskMessage).Payload()))
+	assert.Greater(t, w.Requests(), 1)
+
+	q.Release()
+	_, err = q.Dequeue(context.Background())
+	assert.Equal(t, ErrQueueShutdown, err)
+}
+
+// finishedClock holds back the wait for a job cancelled on shutdown until
+// the job has finished, so that both are ready at once.
+type finishedClock struct {
+	realClock
+	finished chan struct{}
+	calls    int32
+}
+
+func (c *finishedClock) After(d time.Duration) <-chan time.Time {
+	// the first call sets the deadline of the job
+	if atomic.AddInt32(&c.calls, 1) == 1 {
+		return time.After(d)
+	}
+	<-c.finished
+	time.Sleep(10 * time.Millisecond)
+	ch := make(chan time.Time, 1)
+	ch <- time.Now()
+	return ch
+}
+
+func TestShutdownPrefersFinishedJob(t *testing.T) {
+	// select would pick either ready case, try it often enough
+	for i := 0; i < 20; i++ {
+		clock := &finishedClock{finished: make(chan struct{})}
+		q, err := NewQueue(
+			WithWorker(NewRing()),
+			WithClock(clock),
+			WithLogger(NewEmptyLogger()),
+		)
+		assert.NoError(t, err)
+
+		// the job finishes as the queue shuts down
+		close(q.quit)
+		m := &job.Message{
+			Timeout: time.Hour,
+			Task: func(ctx context.Context) error {
+				close(clock.finished)
+				return nil
+			},
+		}
+		assert.NoError(t, q.handle(context.Background(), m))
+	}
+}
+
+func TestQueueIfAbsent(t *testing.T) {
+	release := make(chan struct{})
+	w := NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+		<-release
+		return nil
+	}))
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	id := job.AllowOption{ID: job.String("report")}
+	ok, err := q.QueueIfAbsent(mockMessage{message: "foo"}, id)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// pending, then running: the duplicate is refused
+	ok, err = q.QueueIfAbsent(mockMessage{message: "foo"}, id)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.BusyWorkers() == 1
+	}, time.Second, time.Millisecond)
+	ok, err = q.QueueIfAbsent(mockMessage{message: "foo"}, id)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 0, q.Len())
+
+	// other IDs are not affected
+	ok, err = q.QueueIfAbsent(mockMessage{message: "bar"}, job.AllowOption{ID: job.String("other")})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// the ID is free again once the job finished
+	release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		ok, err := q.QueueIfAbsent(mockMessage{message: "foo"}, id)
+		return ok && err == nil
+	}, time.Second, time.Millisecond)
+	close(release)
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 3
+	}, time.Second, time.Millisecond)
+	q.Release()
+}
+
+func TestQueueIfAbsentErrors(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing(WithQueueSize(1))),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	ok, err := q.QueueIfAbsent(mockMessage{message: "foo"})
+	assert.Equal(t, ErrMissingID, err)
+	assert.False(t, ok)
+	ok, err = q.QueueIfAbsent(nil, job.AllowOption{ID: job.String("a")})
+	assert.Equal(t, ErrNilMessage, err)
+	assert.False(t, ok)
+
+	// a job the worker rejects doesn't keep its ID
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	ok, err = q.QueueIfAbsent(mockMessage{message: "foo"}, job.AllowOption{ID: job.String("a")})
+	assert.ErrorIs(t, err, ErrMaxCapacity)
+	assert.False(t, ok)
+	_, present := q.present.Load("a")
+	assert.False(t, present)
+
+	assert.NoError(t, q.Start())
+	q.Release()
+}
+
+func TestQueueIfAbsentDropped(t *testing.T) {
+	for _, p := range []OverflowPolicy{OverflowDropNewest, OverflowDropOldest} {
+		q, err := NewQueue(
+			WithWorker(NewRing(WithQueueSize(1), WithOverflowPolicy(p))),
+			WithLogger(NewEmptyLogger()),
+		)
+		assert.NoError(t, err)
+
+		ok, err := q.QueueIfAbsent(mockMessage{message: "foo"}, job.AllowOption{ID: job.String("a")})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = q.QueueIfAbsent(mockMessage{message: "bar"}, job.AllowOption{ID: job.String("b")})
+		if p == OverflowDropNewest {
+			// the dropped job is not reported as queued
+			assert.ErrorIs(t, err, ErrTaskDropped)
+			assert.False(t, ok)
+		} else {
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+
+		// the ID of the dropped job is free again
+		dropped := "b"
+		if p == OverflowDropOldest {
+			dropped = "a"
+		}
+		_, present := q.present.Load(dropped)
+		assert.False(t, present, p)
+
+		assert.NoError(t, q.Start())
+		q.Release()
+	}
+}
+
+func TestInlineExecution(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithInlineExecution(),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	inline := func(task job.TaskFunc, retries int64) *job.Message {
+		return &job.Message{
+			Task:        task,
+			RetryCount:  retries,
+			RetryDelay:  time.Millisecond,
+			RetryFactor: 1,
+			RetryMin:    time.Millisecond,
+			RetryMax:    time.Millisecond,
+		}
+	}
+
+	// a zero timeout doesn't expire the job when it runs inline
+	assert.NoError(t, q.run(context.Background(), inline(func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+		return ctx.Err()
+	}, 0)))
+
+	errFailed := errors.New("failed")
+	assert.ErrorIs(t, q.run(context.Background(), inline(func(context.Context) error {
+		return errFailed
+	}, 0)), errFailed)
+
+	var attempts int
+	assert.NoError(t, q.run(context.Background(), inline(func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errFailed
+		}
+		return nil
+	}, 2)))
+	assert.Equal(t, 3, attempts)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = q.run(context.Background(), inline(func(context.Context) error {
+			panic("boom")
+		}, 0))
+	})
+
+	// a job with a timeout still gets its deadline
+	m := inline(func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return nil
+	}, 0)
+	m.Timeout = time.Minute
+	assert.NoError(t, q.run(context.Background(), m))
+}
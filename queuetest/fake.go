@@ -0,0 +1,180 @@
+package queuetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+)
+
+var (
+	_ core.Worker        = (*FakeWorker)(nil)
+	_ core.UsageReporter = (*FakeWorker)(nil)
+)
+
+// ErrClosed is returned by a FakeWorker that has been shut down.
+var ErrClosed = errors.New("queuetest: worker is closed")
+
+// result is what a single Request of the FakeWorker returns.
+type result struct {
+	task core.TaskMessage
+	err  error
+}
+
+// FakeWorker is an in-memory core.Worker whose behavior tests can program
+// without gomock: the results of Request, injected errors and delays. It is
+// safe for concurrent use.
+//
+// Request hands out the queued results in order and reports an empty
+// worker with no task and no error, or ErrClosed once it has been shut down.
+type FakeWorker struct {
+	mu       sync.Mutex
+	results  []result
+	runFunc  func(context.Context, core.TaskMessage) error
+	queueErr error
+	delay    time.Duration
+	requests int
+	ran      []core.TaskMessage
+	closed   bool
+}
+
+// NewFakeWorker returns a FakeWorker handing out tasks first. Its tasks
+// succeed until SetRunFunc says otherwise.
+func NewFakeWorker(tasks ...core.TaskMessage) *FakeWorker {
+	f := &FakeWorker{}
+	f.Push(tasks...)
+	return f
+}
+
+// Push adds tasks to be handed out by Request.
+func (f *FakeWorker) Push(tasks ...core.TaskMessage) {
+	for _, task := range tasks {
+		f.Return(task, nil)
+	}
+}
+
+// FailRequest makes a Request return err without a task once the results
+// queued before it are handed out.
+func (f *FakeWorker) FailRequest(err error) {
+	f.Return(nil, err)
+}
+
+// Return queues any combination of task and error to be returned by a
+// Request, e.g. a task along with an error.
+func (f *FakeWorker) Return(task core.TaskMessage, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results = append(f.results, result{task: task, err: err})
+}
+
+// FailQueue makes Queue return err instead of accepting the tasks, nil
+// accepts them again.
+func (f *FakeWorker) FailQueue(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queueErr = err
+}
+
+// SetRequestDelay makes every Request wait d before returning.
+func (f *FakeWorker) SetRequestDelay(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delay = d
+}
+
+// SetRunFunc set the function Run processes the tasks with.
+func (f *FakeWorker) SetRunFunc(fn func(context.Context, core.TaskMessage) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runFunc = fn
+}
+
+// Requests returns the number of Request calls so far.
+func (f *FakeWorker) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// Ran returns the tasks passed to Run, in order.
+func (f *FakeWorker) Ran() []core.TaskMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]core.TaskMessage(nil), f.ran...)
+}
+
+// Usage returns the number of tasks left to hand out.
+func (f *FakeWorker) Usage() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.results {
+		if r.task != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Run records task and processes it with the run function, if any.
+func (f *FakeWorker) Run(ctx context.Context, task core.TaskMessage) error {
+	f.mu.Lock()
+	f.ran = append(f.ran, task)
+	fn := f.runFunc
+	f.mu.Unlock()
+	if fn == nil {
+		return nil
+	}
+	return fn(ctx, task)
+}
+
+// Shutdown closes the worker, the tasks still queued are handed out before
+// Request reports ErrClosed.
+func (f *FakeWorker) Shutdown() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+// Queue adds task to be handed out by Request, unless FailQueue set an error.
+func (f *FakeWorker) Queue(task core.TaskMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrClosed
+	}
+	if f.queueErr != nil {
+		return f.queueErr
+	}
+	f.results = append(f.results, result{task: task})
+	return nil
+}
+
+// Request returns the next queued result after the request delay.
+func (f *FakeWorker) Request() (core.TaskMessage, error) {
+	f.mu.Lock()
+	f.requests++
+	delay := f.delay
+	f.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.results) > 0 {
+		r := f.results[0]
+		f.results = f.results[1:]
+		return r.task, r.err
+	}
+	if f.closed {
+		return nil, ErrClosed
+	}
+	return nil, nil
+}
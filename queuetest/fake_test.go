@@ -0,0 +1,110 @@
+package queuetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue"
+	"github.com/golang-queue/queue/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeWorkerRequest(t *testing.T) {
+	errBroker := errors.New("broker down")
+	a, b, c := message("a"), message("b"), message("c")
+	f := NewFakeWorker(a)
+	f.FailRequest(errBroker)
+	f.Return(b, errBroker)
+	assert.NoError(t, f.Queue(c))
+	assert.Equal(t, 3, f.Usage())
+
+	for _, want := range []struct {
+		task core.TaskMessage
+		err  error
+	}{
+		{task: a},
+		{err: errBroker},
+		{task: b, err: errBroker},
+		{task: c},
+		{},
+	} {
+		task, err := f.Request()
+		assert.Equal(t, want.task, task)
+		assert.Equal(t, want.err, err)
+	}
+	assert.Equal(t, 5, f.Requests())
+	assert.Equal(t, 0, f.Usage())
+}
+
+func TestFakeWorkerQueue(t *testing.T) {
+	errFull := errors.New("full")
+	f := NewFakeWorker()
+	f.FailQueue(errFull)
+	assert.Equal(t, errFull, f.Queue(message("a")))
+	f.FailQueue(nil)
+	assert.NoError(t, f.Queue(message("b")))
+
+	task, err := f.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, message("b"), task)
+}
+
+func TestFakeWorkerRun(t *testing.T) {
+	errFailed := errors.New("failed")
+	f := NewFakeWorker()
+	assert.NoError(t, f.Run(context.Background(), message("a")))
+	f.SetRunFunc(func(ctx context.Context, task core.TaskMessage) error {
+		return errFailed
+	})
+	assert.Equal(t, errFailed, f.Run(context.Background(), message("b")))
+	assert.Equal(t, []core.TaskMessage{message("a"), message("b")}, f.Ran())
+}
+
+func TestFakeWorkerRequestDelay(t *testing.T) {
+	f := NewFakeWorker(message("a"))
+	f.SetRequestDelay(20 * time.Millisecond)
+	start := time.Now()
+	task, err := f.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, message("a"), task)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestFakeWorkerShutdown(t *testing.T) {
+	f := NewFakeWorker(message("a"))
+	assert.NoError(t, f.Shutdown())
+	assert.Equal(t, ErrClosed, f.Shutdown())
+	assert.Equal(t, ErrClosed, f.Queue(message("b")))
+
+	// the queued tasks are still handed out
+	task, err := f.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, message("a"), task)
+	task, err = f.Request()
+	assert.Nil(t, task)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestFakeWorkerWithQueue(t *testing.T) {
+	f := NewFakeWorker()
+	q, err := queue.NewQueue(
+		queue.WithWorker(f),
+		queue.WithWorkerCount(2),
+		queue.WithPollInterval(time.Millisecond),
+		queue.WithLogger(queue.NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	for _, body := range []string{"a", "b", "c"} {
+		assert.NoError(t, q.Queue(message(body)))
+	}
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 3
+	}, time.Second, time.Millisecond)
+	q.Release()
+	assert.Len(t, f.Ran(), 3)
+}
@@ -0,0 +1,153 @@
+// Package queuetest provides helpers for authors of workers to check that
+// their implementation behaves like the workers shipped with the queue, and
+// a FakeWorker for testing code built on the queue.
+package queuetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type message string
+
+func (m message) Bytes() []byte {
+	return []byte(m)
+}
+
+func (m message) Payload() []byte {
+	return []byte(m)
+}
+
+// newMessage returns a job message with every encodable field set.
+func newMessage(body string) *job.Message {
+	m := job.NewMessage(message(body), job.AllowOption{
+		ID:             job.String("id-" + body),
+		RetryCount:     job.Int64(3),
+		RetryDelay:     job.Time(2 * time.Second),
+		RetryFactor:    job.Float64(1.5),
+		RetryMin:       job.Time(time.Second),
+		RetryMax:       job.Time(time.Minute),
+		Jitter:         job.Bool(true),
+		Timeout:        job.Time(time.Hour),
+		TotalTimeout:   job.Time(2 * time.Hour),
+		ConcurrencyKey: job.String("key-" + body),
+	})
+	return &m
+}
+
+// AssertRoundTrip checks that a job message decoded from its encoded form
+// equals the original, task functions aside since they can't be encoded.
+func AssertRoundTrip(t testing.TB, encode func(*job.Message) []byte, decode func([]byte) *job.Message) {
+	t.Helper()
+
+	for _, m := range []*job.Message{
+		newMessage("foo"),
+		{Body: []byte{}},
+		{Body: []byte{0, 1, 2, 255}},
+	} {
+		got := decode(encode(m))
+		if !assert.NotNil(t, got) {
+			continue
+		}
+		assert.Equal(t, m.ID, got.ID)
+		assert.Equal(t, m.Payload(), got.Payload())
+		assert.Equal(t, m.Timeout, got.Timeout)
+		assert.Equal(t, m.TotalTimeout, got.TotalTimeout)
+		assert.Equal(t, m.RetryCount, got.RetryCount)
+		assert.Equal(t, m.RetryDelay, got.RetryDelay)
+		assert.Equal(t, m.RetryFactor, got.RetryFactor)
+		assert.Equal(t, m.RetryMin, got.RetryMin)
+		assert.Equal(t, m.RetryMax, got.RetryMax)
+		assert.Equal(t, m.Jitter, got.Jitter)
+		assert.Equal(t, m.ConcurrencyKey, got.ConcurrencyKey)
+	}
+}
+
+// RunWorkerConformance runs the behavior every core.Worker is expected to
+// have. newWorker must return a fresh, empty worker on every call whose run
+// function succeeds; the suite shuts the workers down itself.
+func RunWorkerConformance(t *testing.T, newWorker func() core.Worker) {
+	t.Run("RequestEmpty", func(t *testing.T) {
+		w := newWorker()
+		task, err := w.Request()
+		assert.Nil(t, task)
+		assert.Error(t, err)
+		assert.NoError(t, w.Shutdown())
+	})
+
+	t.Run("QueueRequestRun", func(t *testing.T) {
+		w := newWorker()
+		m := newMessage("foo")
+		require.NoError(t, w.Queue(m))
+
+		task := request(t, w)
+		require.NotNil(t, task)
+		assert.Equal(t, m.Payload(), task.Payload())
+		assert.NoError(t, w.Run(context.Background(), task))
+
+		// a handled task is not delivered again
+		task, err := w.Request()
+		assert.Nil(t, task)
+		assert.Error(t, err)
+		assert.NoError(t, w.Shutdown())
+	})
+
+	t.Run("Backlog", func(t *testing.T) {
+		w := newWorker()
+		total := 100
+		want := make(map[string]bool, total)
+		for i := 0; i < total; i++ {
+			body := fmt.Sprint(i)
+			want[body] = true
+			require.NoError(t, w.Queue(newMessage(body)))
+		}
+
+		for i := 0; i < total; i++ {
+			task := request(t, w)
+			require.NotNil(t, task)
+			body := string(task.Payload())
+			assert.True(t, want[body], "unexpected or duplicated task %q", body)
+			delete(want, body)
+			assert.NoError(t, w.Run(context.Background(), task))
+		}
+		assert.Empty(t, want)
+		assert.NoError(t, w.Shutdown())
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		w := newWorker()
+		assert.NoError(t, w.Shutdown())
+		assert.Error(t, w.Shutdown())
+		assert.Error(t, w.Queue(newMessage("foo")))
+
+		task, err := w.Request()
+		assert.Nil(t, task)
+		assert.Error(t, err)
+	})
+}
+
+// request waits a little for a task, remote workers may deliver
+// asynchronously.
+func request(t *testing.T, w core.Worker) core.TaskMessage {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		task, err := w.Request()
+		if task != nil && err == nil {
+			return task
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("no task delivered: %v", err)
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,22 @@
+package queuetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-queue/queue"
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+)
+
+func TestRoundTrip(t *testing.T) {
+	AssertRoundTrip(t, job.Encode, job.Decode)
+}
+
+func TestRingConformance(t *testing.T) {
+	RunWorkerConformance(t, func() core.Worker {
+		return queue.NewRing(queue.WithFn(func(context.Context, core.TaskMessage) error {
+			return nil
+		}))
+	})
+}
@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang-queue/queue/job"
+)
+
+// Result is the outcome of a task queued by QueueTaskWithResult.
+type Result struct {
+	// Value is the value returned by the task.
+	Value interface{}
+	// Err is the error returned by the task, or the error
+	// that stopped it such as a timeout.
+	Err error
+}
+
+// QueueTaskWithResult queues a single task returning a value. The returned
+// channel receives exactly one Result once a worker has handled the task.
+func (q *Queue) QueueTaskWithResult(fn job.ResultFunc, opts ...job.AllowOption) (<-chan Result, error) {
+	if fn == nil {
+		return nil, ErrNilTask
+	}
+
+	var (
+		mu    sync.Mutex
+		value interface{}
+	)
+
+	data := job.NewTask(func(ctx context.Context) error {
+		v, err := fn(ctx)
+		mu.Lock()
+		value = v
+		mu.Unlock()
+		return err
+	}, q.mergeJobOptions(opts...))
+
+	result := make(chan Result, 1)
+	q.waiters.Store(&data, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		result <- Result{Value: value, Err: err}
+	})
+
+	if err := q.queue(&data); err != nil {
+		q.waiters.Delete(&data)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// QueueBatchAndWait queues the tasks and blocks until all of them have been
+// handled. The returned slice holds the error of every task in submission
+// order, nil for the ones that succeeded. Tasks that could not be queued get
+// the queueing error. When ctx is done first, the tasks not finished yet get
+// ctx.Err(); they are not cancelled and still run.
+func (q *Queue) QueueBatchAndWait(ctx context.Context, tasks []job.TaskFunc, opts ...job.AllowOption) []error {
+	errs := make([]error, len(tasks))
+	results := make([]<-chan Result, len(tasks))
+	for i, task := range tasks {
+		if task == nil {
+			errs[i] = ErrNilTask
+			continue
+		}
+		task := task
+		results[i], errs[i] = q.QueueTaskWithResult(func(ctx context.Context) (interface{}, error) {
+			return nil, task(ctx)
+		}, opts...)
+	}
+
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		select {
+		case r := <-result:
+			errs[i] = r.Err
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+
+	return errs
+}
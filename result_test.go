@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/job"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueTaskWithResult(t *testing.T) {
+	q := NewPool(2, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	result, err := q.QueueTaskWithResult(func(ctx context.Context) (interface{}, error) {
+		return "foobar", nil
+	})
+	assert.NoError(t, err)
+
+	r := <-result
+	assert.NoError(t, r.Err)
+	assert.Equal(t, "foobar", r.Value)
+
+	// the future only resolves once
+	select {
+	case <-result:
+		t.Fatal("result delivered twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestQueueTaskWithResultError(t *testing.T) {
+	q := NewPool(2, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	result, err := q.QueueTaskWithResult(func(ctx context.Context) (interface{}, error) {
+		return 42, errors.New("partial result")
+	})
+	assert.NoError(t, err)
+
+	r := <-result
+	assert.EqualError(t, r.Err, "partial result")
+	assert.Equal(t, 42, r.Value)
+}
+
+func TestQueueTaskWithResultAfterShutdown(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	q.Release()
+
+	result, err := q.QueueTaskWithResult(func(ctx context.Context) (interface{}, error) {
+		return nil, nil
+	})
+	assert.Nil(t, result)
+	assert.Equal(t, ErrQueueShutdown, err)
+}
+
+func TestQueueBatchAndWait(t *testing.T) {
+	q := NewPool(3, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	errFailed := errors.New("failed")
+	errs := q.QueueBatchAndWait(context.Background(), []job.TaskFunc{
+		func(ctx context.Context) error {
+			time.Sleep(30 * time.Millisecond)
+			return nil
+		},
+		func(ctx context.Context) error {
+			return errFailed
+		},
+		func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		},
+		func(ctx context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			return errFailed
+		},
+	})
+
+	assert.Len(t, errs, 4)
+	assert.NoError(t, errs[0])
+	assert.Equal(t, errFailed, errs[1])
+	assert.NoError(t, errs[2])
+	assert.Equal(t, errFailed, errs[3])
+}
+
+func TestQueueBatchAndWaitContextDone(t *testing.T) {
+	q := NewPool(2, WithLogger(NewEmptyLogger()))
+	defer q.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	errs := q.QueueBatchAndWait(ctx, []job.TaskFunc{
+		func(ctx context.Context) error {
+			return nil
+		},
+		func(ctx context.Context) error {
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		},
+	})
+
+	assert.NoError(t, errs[0])
+	assert.Equal(t, context.DeadlineExceeded, errs[1])
+}
+
+func TestQueueBatchAndWaitAfterShutdown(t *testing.T) {
+	q := NewPool(1, WithLogger(NewEmptyLogger()))
+	q.Release()
+
+	errs := q.QueueBatchAndWait(context.Background(), []job.TaskFunc{
+		func(ctx context.Context) error {
+			return nil
+		},
+	})
+	assert.Equal(t, []error{ErrQueueShutdown}, errs)
+}
@@ -6,44 +6,84 @@ import (
 	"sync/atomic"
 
 	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
 )
 
-var _ core.Worker = (*Ring)(nil)
+var (
+	_ core.Worker           = (*Ring)(nil)
+	_ core.BatchRequester   = (*Ring)(nil)
+	_ core.ContextRequester = (*Ring)(nil)
+	_ core.LocalWorker      = (*Ring)(nil)
+	_ core.UsageReporter    = (*Ring)(nil)
+	_ core.CapacityReporter = (*Ring)(nil)
+	_ core.DropNotifier     = (*Ring)(nil)
+)
 
-// Ring represents a simple queue using a buffer channel.
+// Ring represents a simple in-memory queue, handing out the tasks in FIFO
+// order unless a Scheduler is set with WithScheduler.
 type Ring struct {
 	sync.Mutex
-	taskQueue []core.TaskMessage                            // taskQueue holds the tasks in the ring buffer.
-	runFunc   func(context.Context, core.TaskMessage) error // runFunc is the function responsible for processing tasks.
-	capacity  int                                           // capacity is the maximum number of tasks the queue can hold.
-	count     int                                           // count is the current number of tasks in the queue.
-	head      int                                           // head is the index of the first task in the queue.
-	tail      int                                           // tail is the index where the next task will be added.
-	exit      chan struct{}                                 // exit is used to signal when the queue is shutting down.
-	logger    Logger                                        // logger is used for logging messages.
-	stopOnce  sync.Once                                     // stopOnce ensures the shutdown process only runs once.
-	stopFlag  int32                                         // stopFlag indicates whether the queue is shutting down.
+	scheduler   Scheduler                                     // scheduler holds the tasks and decides their order.
+	runFunc     func(context.Context, core.TaskMessage) error // runFunc is the function responsible for processing tasks.
+	capacity    int                                           // capacity is the maximum number of tasks the queue can hold.
+	maxBytes    int                                           // maxBytes is the maximum summed payload size the queue can hold.
+	bytes       int                                           // bytes is the summed payload size of the tasks in the queue.
+	count       int                                           // count is the current number of tasks in the queue.
+	exit        chan struct{}                                 // exit is used to signal when the queue is shutting down.
+	logger      Logger                                        // logger is used for logging messages.
+	stopOnce    sync.Once                                     // stopOnce ensures the shutdown process only runs once.
+	stopFlag    int32                                         // stopFlag indicates whether the queue is shutting down.
+	overflow    OverflowPolicy                                // overflow decides what happens to new tasks once the queue is full.
+	dropped     uint64                                        // dropped counts the tasks discarded by the overflow policy.
+	persistPath string                                        // persistPath is the file buffered messages are saved to on shutdown.
+	notify      chan struct{}                                 // notify wakes up a RequestWithContext waiting for a task.
+	onDrop      func(core.TaskMessage)                        // onDrop is told about the tasks evicted by the overflow policy.
 }
 
 // Run executes a new task using the provided context and task message.
 // It calls the runFunc function, which is responsible for processing the task.
 // The context allows for cancellation and timeout control of the task execution.
 func (s *Ring) Run(ctx context.Context, task core.TaskMessage) error {
-	return s.runFunc(ctx, task)
+	s.Lock()
+	fn := s.runFunc
+	s.Unlock()
+	if fn == nil {
+		return ErrMissingRunFunc
+	}
+	return fn(ctx, task)
+}
+
+// SetRunFunc replaces the function processing the tasks. Tasks started
+// afterwards, including the retries of running jobs, use fn while the
+// running ones finish with the previous function.
+func (s *Ring) SetRunFunc(fn func(context.Context, core.TaskMessage) error) {
+	s.Lock()
+	s.runFunc = fn
+	s.Unlock()
 }
 
 // Shutdown gracefully shuts down the worker.
 // It sets the stopFlag to indicate that the queue is shutting down and prevents new tasks from being added.
 // If the queue is already shut down, it returns ErrQueueShutdown.
-// It waits for all tasks to be processed before completing the shutdown.
+// With WithPersistence, buffered payload messages are written to disk first.
+// It waits for all remaining tasks to be processed before completing the shutdown.
 func (s *Ring) Shutdown() error {
 	// Attempt to set the stopFlag from 0 to 1. If it fails, the queue is already shut down.
 	if !atomic.CompareAndSwapInt32(&s.stopFlag, 0, 1) {
 		return ErrQueueShutdown
 	}
 
+	// Wake up a waiting RequestWithContext so that it sees the queue is closed.
+	s.wake()
+
 	// Ensure the shutdown process only runs once.
+	var err error
 	s.stopOnce.Do(func() {
+		// Hand the persistable tasks over to disk instead of running them.
+		if s.persistPath != "" {
+			err = s.persist()
+		}
+
 		s.Lock()
 		count := s.count
 		s.Unlock()
@@ -52,33 +92,160 @@ func (s *Ring) Shutdown() error {
 			<-s.exit
 		}
 	})
-	return nil
+	return err
 }
 
 // Queue adds a task to the ring buffer queue.
-// It returns an error if the queue is shut down or has reached its maximum capacity.
+// It returns an error if the queue is shut down, has reached its maximum capacity
+// or the task payload would exceed the byte budget, unless the overflow policy
+// evicts buffered tasks instead. Under OverflowDropNewest the task is dropped
+// with ErrTaskDropped.
 func (s *Ring) Queue(task core.TaskMessage) error { //nolint:stylecheck
 	// Check if the queue is shut down
 	if atomic.LoadInt32(&s.stopFlag) == 1 {
 		return ErrQueueShutdown
 	}
+
+	// Only measure the payload when a byte budget is configured
+	size := 0
+	if s.maxBytes > 0 {
+		size = len(task.Payload())
+	}
+
+	// A payload larger than the whole budget can never fit, don't drop
+	// buffered tasks for it
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return ErrMaxBytes
+	}
+
+	var evicted []core.TaskMessage
+	s.Lock()
+	for {
+		err := s.fits(size)
+		if err == nil {
+			break
+		}
+		switch {
+		case s.overflow == OverflowDropOldest && s.count > 0:
+			evicted = append(evicted, s.pop())
+			atomic.AddUint64(&s.dropped, 1)
+		case s.overflow == OverflowDropNewest:
+			s.Unlock()
+			atomic.AddUint64(&s.dropped, 1)
+			return ErrTaskDropped
+		default:
+			s.Unlock()
+			return err
+		}
+	}
+
+	s.push(task, size)
+	onDrop := s.onDrop
+	s.Unlock()
+	s.wake()
+
+	if onDrop != nil {
+		for _, t := range evicted {
+			onDrop(t)
+		}
+	}
+
+	return nil
+}
+
+// OnDrop sets the function told about the buffered tasks evicted by
+// OverflowDropOldest.
+func (s *Ring) OnDrop(fn func(core.TaskMessage)) {
+	s.Lock()
+	s.onDrop = fn
+	s.Unlock()
+}
+
+// wake signals a waiting RequestWithContext without blocking.
+func (s *Ring) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// push hands task to the scheduler. The caller must hold the lock.
+func (s *Ring) push(task core.TaskMessage, size int) {
+	s.scheduler.Push(task)
+	s.count++
+	s.bytes += size
+}
+
+// fits reports whether a task of the given payload size can be added
+// without going over the capacity or the byte budget. The caller must hold the lock.
+func (s *Ring) fits(size int) error {
 	// Check if the queue has reached its maximum capacity
 	if s.capacity > 0 && s.count >= s.capacity {
 		return ErrMaxCapacity
 	}
+	// Check if the payload fits in the byte budget
+	if s.maxBytes > 0 && s.bytes+size > s.maxBytes {
+		return ErrMaxBytes
+	}
+	return nil
+}
 
+// Peek returns a snapshot of the buffered tasks in the order they are
+// handed out without removing them.
+func (s *Ring) Peek() []core.QueuedMessage {
 	s.Lock()
-	// Resize the queue if necessary
-	if s.count == len(s.taskQueue) {
-		s.resize(s.count * 2)
+	defer s.Unlock()
+	tasks := make([]core.QueuedMessage, 0, s.count)
+	for _, task := range s.scheduler.Tasks() {
+		tasks = append(tasks, task)
 	}
-	// Add the task to the queue
-	s.taskQueue[s.tail] = task
-	s.tail = (s.tail + 1) % len(s.taskQueue)
-	s.count++
-	s.Unlock()
+	return tasks
+}
 
-	return nil
+// Remove takes the first buffered job message with the given ID out of the
+// queue and returns it. It reports false when no such job is buffered.
+func (s *Ring) Remove(id string) (core.TaskMessage, bool) {
+	s.Lock()
+	defer s.Unlock()
+	var removed *job.Message
+	s.scheduler.Filter(func(task core.TaskMessage) bool {
+		if m, ok := task.(*job.Message); ok && removed == nil && m.ID == id {
+			removed = m
+			return false
+		}
+		return true
+	})
+	if removed == nil {
+		return nil, false
+	}
+
+	s.count--
+	if s.maxBytes > 0 {
+		s.bytes -= len(removed.Payload())
+	}
+	return removed, true
+}
+
+// Local reports true, the ring keeps its tasks in memory.
+func (s *Ring) Local() bool {
+	return true
+}
+
+// Usage returns the number of buffered tasks.
+func (s *Ring) Usage() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.count
+}
+
+// Capacity returns the maximum number of buffered tasks, zero means no limit.
+func (s *Ring) Capacity() int {
+	return s.capacity
+}
+
+// DroppedTasks returns the number of tasks discarded by the overflow policy.
+func (s *Ring) DroppedTasks() uint64 {
+	return atomic.LoadUint64(&s.dropped)
 }
 
 // Request retrieves the next task message from the ring queue.
@@ -104,43 +271,70 @@ func (s *Ring) Request() (core.TaskMessage, error) {
 	if s.count == 0 {
 		return nil, ErrNoTaskInQueue
 	}
-	data := s.taskQueue[s.head]
-	s.taskQueue[s.head] = nil
-	s.head = (s.head + 1) % len(s.taskQueue)
-	s.count--
 
-	if n := len(s.taskQueue) / 2; n >= 2 && s.count <= n {
-		s.resize(n)
+	return s.pop(), nil
+}
+
+// RequestWithContext retrieves the next task message like Request, but
+// waits for a task to be queued when the queue is empty. It returns ctx.Err()
+// when ctx is done first.
+func (s *Ring) RequestWithContext(ctx context.Context) (core.TaskMessage, error) {
+	for {
+		task, err := s.Request()
+		if err != ErrNoTaskInQueue {
+			return task, err
+		}
+
+		select {
+		case <-s.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
+}
 
-	return data, nil
+// RequestBatch retrieves up to n task messages from the ring queue in one call.
+// It returns the same errors as Request when the queue is empty or closed.
+func (s *Ring) RequestBatch(n int) ([]core.TaskMessage, error) {
+	if atomic.LoadInt32(&s.stopFlag) == 1 && s.count == 0 {
+		select {
+		case s.exit <- struct{}{}:
+		default:
+		}
+		return nil, ErrQueueHasBeenClosed
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.count == 0 {
+		return nil, ErrNoTaskInQueue
+	}
+	if n > s.count {
+		n = s.count
+	}
+
+	tasks := make([]core.TaskMessage, 0, n)
+	for i := 0; i < n; i++ {
+		tasks = append(tasks, s.pop())
+	}
+
+	return tasks, nil
 }
 
-// resize adjusts the size of the ring buffer to the specified capacity n.
-// It reallocates the underlying slice to the new size and copies the existing
-// elements to the new slice in the correct order. The head and tail pointers
-// are updated accordingly to maintain the correct order of elements in the
-// resized buffer.
-//
-// Parameters:
-//
-//	n - the new capacity of the ring buffer.
-func (q *Ring) resize(n int) {
-	nodes := make([]core.TaskMessage, n)
-	if q.head < q.tail {
-		copy(nodes, q.taskQueue[q.head:q.tail])
-	} else {
-		copy(nodes, q.taskQueue[q.head:])
-		copy(nodes[len(q.taskQueue)-q.head:], q.taskQueue[:q.tail])
+// pop removes the next task from the scheduler. The caller must hold the
+// lock and make sure the queue is not empty.
+func (s *Ring) pop() core.TaskMessage {
+	data, _ := s.scheduler.Pop()
+	s.count--
+	if s.maxBytes > 0 {
+		s.bytes -= len(data.Payload())
 	}
 
-	q.tail = q.count % n
-	q.head = 0
-	q.taskQueue = nodes
+	return data
 }
 
 // NewRing creates a new Ring instance with the provided options.
-// It initializes the task queue with a default size of 2, sets the capacity
+// It initializes the task queue with the configured scheduler, sets the capacity
 // based on the provided options, and configures the logger and run function.
 // The function returns a pointer to the newly created Ring instance.
 //
@@ -154,11 +348,26 @@ func (q *Ring) resize(n int) {
 func NewRing(opts ...Option) *Ring {
 	o := NewOptions(opts...)
 	w := &Ring{
-		taskQueue: make([]core.TaskMessage, 2),
+		scheduler: o.scheduler,
 		capacity:  o.queueSize,
+		maxBytes:  o.maxBytes,
 		exit:      make(chan struct{}),
+		notify:    make(chan struct{}, 1),
 		logger:    o.logger,
 		runFunc:   o.fn,
+		overflow:  o.overflowPolicy,
+
+		persistPath: o.persistPath,
+	}
+
+	if w.scheduler == nil {
+		w.scheduler = newFIFO()
+	}
+
+	if w.persistPath != "" {
+		if err := w.restore(); err != nil {
+			w.logger.Errorf("restore queue from %s: %s", w.persistPath, err.Error())
+		}
 	}
 
 	return w
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -48,7 +49,7 @@ func TestCustomFuncAndWait(t *testing.T) {
 	assert.NoError(t, q.Queue(m))
 	assert.NoError(t, q.Queue(m))
 	assert.NoError(t, q.Queue(m))
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(100 * time.Millisecond)
 	assert.Equal(t, 2, int(q.metric.BusyWorkers()))
 	time.Sleep(600 * time.Millisecond)
@@ -67,7 +68,7 @@ func TestEnqueueJobAfterShutdown(t *testing.T) {
 		WithWorkerCount(2),
 	)
 	assert.NoError(t, err)
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(50 * time.Millisecond)
 	q.Shutdown()
 	// can't queue task after shutdown
@@ -105,7 +106,7 @@ func TestJobReachTimeout(t *testing.T) {
 	)
 	assert.NoError(t, err)
 	assert.NoError(t, q.Queue(m, job.AllowOption{Timeout: job.Time(30 * time.Millisecond)}))
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(50 * time.Millisecond)
 	q.Release()
 }
@@ -140,7 +141,7 @@ func TestCancelJobAfterShutdown(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, q.Queue(m, job.AllowOption{Timeout: job.Time(100 * time.Millisecond)}))
 	assert.NoError(t, q.Queue(m, job.AllowOption{Timeout: job.Time(100 * time.Millisecond)}))
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(10 * time.Millisecond)
 	assert.Equal(t, int64(2), q.BusyWorkers())
 	q.Release()
@@ -181,7 +182,7 @@ func TestGoroutineLeak(t *testing.T) {
 		assert.NoError(t, q.Queue(m))
 	}
 
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(1 * time.Second)
 	q.Release()
 	fmt.Println("number of goroutines:", runtime.NumGoroutine())
@@ -202,7 +203,7 @@ func TestGoroutinePanic(t *testing.T) {
 	)
 	assert.NoError(t, err)
 	assert.NoError(t, q.Queue(m))
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(10 * time.Millisecond)
 	q.Release()
 }
@@ -229,7 +230,7 @@ func TestIncreaseWorkerCount(t *testing.T) {
 		assert.NoError(t, q.Queue(m))
 	}
 
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(100 * time.Millisecond)
 	assert.Equal(t, int64(5), q.BusyWorkers())
 	q.UpdateWorkerCount(10)
@@ -259,7 +260,7 @@ func TestDecreaseWorkerCount(t *testing.T) {
 		assert.NoError(t, q.Queue(m))
 	}
 
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(20 * time.Millisecond)
 	assert.Equal(t, int64(5), q.BusyWorkers())
 	q.UpdateWorkerCount(3)
@@ -331,7 +332,7 @@ func TestHandleAllJobBeforeShutdownRingInQueue(t *testing.T) {
 	assert.NoError(t, q.Queue(m))
 	assert.NoError(t, q.Queue(m))
 	assert.Len(t, messages, 0)
-	q.Start()
+	assert.NoError(t, q.Start())
 	q.Release()
 	assert.Len(t, messages, 2)
 }
@@ -374,7 +375,7 @@ func TestRetryCountWithNewMessage(t *testing.T) {
 		},
 	))
 	assert.Len(t, messages, 0)
-	q.Start()
+	assert.NoError(t, q.Start())
 	// wait retry twice.
 	<-keep
 	q.Release()
@@ -411,7 +412,7 @@ func TestRetryCountWithNewTask(t *testing.T) {
 		},
 	))
 	assert.Len(t, messages, 0)
-	q.Start()
+	assert.NoError(t, q.Start())
 	// wait retry twice.
 	<-keep
 	q.Release()
@@ -447,7 +448,7 @@ func TestCancelRetryCountWithNewTask(t *testing.T) {
 		},
 	))
 	assert.Len(t, messages, 0)
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(50 * time.Millisecond)
 	q.Release()
 	assert.Len(t, messages, 0)
@@ -490,7 +491,7 @@ func TestCancelRetryCountWithNewMessage(t *testing.T) {
 		},
 	))
 	assert.Len(t, messages, 0)
-	q.Start()
+	assert.NoError(t, q.Start())
 	time.Sleep(50 * time.Millisecond)
 	q.Release()
 	assert.Len(t, messages, 0)
@@ -508,3 +509,362 @@ func TestErrNoTaskInQueue(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, ErrNoTaskInQueue, err)
 }
+
+func TestMaxBytes(t *testing.T) {
+	w := NewRing(WithMaxBytes(10))
+
+	// the byte budget, not the task count, is the binding constraint
+	assert.NoError(t, w.Queue(&mockMessage{message: "123"}))
+	assert.NoError(t, w.Queue(&mockMessage{message: "1234"}))
+	assert.NoError(t, w.Queue(&mockMessage{message: ""}))
+	assert.Equal(t, ErrMaxBytes, w.Queue(&mockMessage{message: "1234"}))
+	assert.NoError(t, w.Queue(&mockMessage{message: "123"}))
+	assert.Equal(t, ErrMaxBytes, w.Queue(&mockMessage{message: "1"}))
+
+	// dequeuing frees the budget of the removed payload
+	task, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "123", string(task.Payload()))
+	assert.NoError(t, w.Queue(&mockMessage{message: "12"}))
+	assert.Equal(t, ErrMaxBytes, w.Queue(&mockMessage{message: "12"}))
+}
+
+func TestRequestBatch(t *testing.T) {
+	w := NewRing()
+
+	_, err := w.RequestBatch(2)
+	assert.Equal(t, ErrNoTaskInQueue, err)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, w.Queue(&mockMessage{message: fmt.Sprint(i)}))
+	}
+
+	tasks, err := w.RequestBatch(3)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 3)
+	for i, task := range tasks {
+		assert.Equal(t, fmt.Sprint(i), string(task.Payload()))
+	}
+
+	// asking for more than is buffered drains the rest
+	tasks, err = w.RequestBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "3", string(tasks[0].Payload()))
+	assert.Equal(t, "4", string(tasks[1].Payload()))
+
+	assert.NoError(t, w.Shutdown())
+	_, err = w.RequestBatch(1)
+	assert.Equal(t, ErrQueueHasBeenClosed, err)
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	payloads := func(w *Ring) []string {
+		var out []string
+		for {
+			task, err := w.Request()
+			if err != nil {
+				return out
+			}
+			out = append(out, string(task.Payload()))
+		}
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		w := NewRing(WithQueueSize(2))
+		assert.NoError(t, w.Queue(&mockMessage{message: "1"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "2"}))
+		assert.Equal(t, ErrMaxCapacity, w.Queue(&mockMessage{message: "3"}))
+		assert.Equal(t, []string{"1", "2"}, payloads(w))
+		assert.Equal(t, uint64(0), w.DroppedTasks())
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		var evicted []string
+		w := NewRing(WithQueueSize(2), WithOverflowPolicy(OverflowDropOldest))
+		w.OnDrop(func(task core.TaskMessage) {
+			evicted = append(evicted, string(task.Payload()))
+		})
+		assert.NoError(t, w.Queue(&mockMessage{message: "1"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "2"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "3"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "4"}))
+		assert.Equal(t, []string{"3", "4"}, payloads(w))
+		assert.Equal(t, []string{"1", "2"}, evicted)
+		assert.Equal(t, uint64(2), w.DroppedTasks())
+	})
+
+	t.Run("drop oldest bytes", func(t *testing.T) {
+		w := NewRing(WithMaxBytes(4), WithOverflowPolicy(OverflowDropOldest))
+		assert.NoError(t, w.Queue(&mockMessage{message: "11"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "22"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "333"}))
+		assert.Equal(t, []string{"333"}, payloads(w))
+		assert.Equal(t, uint64(2), w.DroppedTasks())
+
+		// a payload larger than the whole budget can never fit
+		assert.Equal(t, ErrMaxBytes, w.Queue(&mockMessage{message: "55555"}))
+	})
+
+	t.Run("drop oldest oversized", func(t *testing.T) {
+		w := NewRing(WithMaxBytes(10), WithOverflowPolicy(OverflowDropOldest))
+		assert.NoError(t, w.Queue(&mockMessage{message: "111"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "222"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "333"}))
+		assert.Equal(t, ErrMaxBytes, w.Queue(&mockMessage{message: "4444444444444444"}))
+		assert.Equal(t, uint64(0), w.DroppedTasks())
+		assert.Equal(t, []string{"111", "222", "333"}, payloads(w))
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		w := NewRing(WithQueueSize(2), WithOverflowPolicy(OverflowDropNewest))
+		assert.NoError(t, w.Queue(&mockMessage{message: "1"}))
+		assert.NoError(t, w.Queue(&mockMessage{message: "2"}))
+		assert.Equal(t, ErrTaskDropped, w.Queue(&mockMessage{message: "3"}))
+		assert.Equal(t, []string{"1", "2"}, payloads(w))
+		assert.Equal(t, uint64(1), w.DroppedTasks())
+	})
+}
+
+func TestOverflowPolicySettlesJobs(t *testing.T) {
+	noop := func(context.Context) (interface{}, error) { return nil, nil }
+	newQueue := func(t *testing.T, p OverflowPolicy) *Queue {
+		q, err := NewQueue(
+			WithWorker(NewRing(WithQueueSize(1), WithOverflowPolicy(p))),
+			WithLogger(NewEmptyLogger()),
+		)
+		assert.NoError(t, err)
+		return q
+	}
+
+	t.Run("drop oldest", func(t *testing.T) {
+		q := newQueue(t, OverflowDropOldest)
+		first, err := q.QueueTaskWithResult(noop, job.AllowOption{ID: job.String("first")})
+		assert.NoError(t, err)
+		second, err := q.QueueTaskWithResult(noop, job.AllowOption{ID: job.String("second")})
+		assert.NoError(t, err)
+
+		// the evicted job fails at once
+		select {
+		case r := <-first:
+			assert.ErrorIs(t, r.Err, ErrTaskDropped)
+		case <-time.After(time.Second):
+			t.Fatal("the result of the evicted job never settles")
+		}
+		status, ok := q.Status("first")
+		assert.True(t, ok)
+		assert.Equal(t, JobFailed, status)
+		status, _ = q.Status("second")
+		assert.Equal(t, JobPending, status)
+		assert.Equal(t, uint64(1), q.DroppedTasks())
+
+		assert.NoError(t, q.Start())
+		assert.NoError(t, (<-second).Err)
+		q.Release()
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		q := newQueue(t, OverflowDropNewest)
+		first, err := q.QueueTaskWithResult(noop, job.AllowOption{ID: job.String("first")})
+		assert.NoError(t, err)
+		_, err = q.QueueTaskWithResult(noop, job.AllowOption{ID: job.String("second")})
+		assert.ErrorIs(t, err, ErrTaskDropped)
+		assert.ErrorIs(t, err, ErrCategoryCapacity)
+
+		// the dropped job is forgotten, the buffered one is untouched
+		_, ok := q.Status("second")
+		assert.False(t, ok)
+		status, _ := q.Status("first")
+		assert.Equal(t, JobPending, status)
+
+		assert.NoError(t, q.Start())
+		assert.NoError(t, (<-first).Err)
+		q.Release()
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		q := newQueue(t, OverflowReject)
+		first, err := q.QueueTaskWithResult(noop, job.AllowOption{ID: job.String("first")})
+		assert.NoError(t, err)
+		_, err = q.QueueTaskWithResult(noop, job.AllowOption{ID: job.String("second")})
+		assert.ErrorIs(t, err, ErrMaxCapacity)
+		_, ok := q.Status("second")
+		assert.False(t, ok)
+
+		assert.NoError(t, q.Start())
+		assert.NoError(t, (<-first).Err)
+		q.Release()
+	})
+}
+
+func TestPeek(t *testing.T) {
+	w := NewRing()
+	assert.Empty(t, w.Peek())
+	assert.Equal(t, 0, w.Usage())
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, w.Queue(&mockMessage{message: fmt.Sprint(i)}))
+	}
+	// move the head so that the snapshot wraps around the buffer
+	_, err := w.Request()
+	assert.NoError(t, err)
+	assert.NoError(t, w.Queue(&mockMessage{message: "5"}))
+
+	peek := func() []string {
+		var out []string
+		for _, m := range w.Peek() {
+			out = append(out, string(m.Bytes()))
+		}
+		return out
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, peek())
+	assert.Equal(t, 5, w.Usage())
+
+	// peeking doesn't consume
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, peek())
+	assert.Equal(t, 5, w.Usage())
+
+	task, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(task.Payload()))
+	assert.Equal(t, []string{"2", "3", "4", "5"}, peek())
+	assert.Equal(t, 4, w.Usage())
+}
+
+func TestRemove(t *testing.T) {
+	w := NewRing(WithMaxBytes(100))
+	for i := 0; i < 5; i++ {
+		m := job.NewMessage(&mockMessage{message: fmt.Sprint(i)}, job.AllowOption{
+			ID: job.String(fmt.Sprint("id-", i)),
+		})
+		assert.NoError(t, w.Queue(&m))
+	}
+	// move the head so that the removal wraps around the buffer
+	_, err := w.Request()
+	assert.NoError(t, err)
+
+	task, ok := w.Remove("id-2")
+	assert.True(t, ok)
+	assert.Equal(t, "2", string(task.Payload()))
+	_, ok = w.Remove("id-2")
+	assert.False(t, ok)
+	_, ok = w.Remove("id-0")
+	assert.False(t, ok)
+	assert.Equal(t, 3, w.bytes)
+
+	var got []string
+	for _, m := range w.Peek() {
+		got = append(got, string(m.(*job.Message).Payload()))
+	}
+	assert.Equal(t, []string{"1", "3", "4"}, got)
+}
+
+func TestTaskFuncPrecedence(t *testing.T) {
+	var ran []string
+	w := NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+		ran = append(ran, "run func: "+string(m.Payload()))
+		return nil
+	}))
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		ran = append(ran, "task")
+		return nil
+	}))
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, []string{"task", "run func: foo"}, ran)
+}
+
+func TestMissingRunFunc(t *testing.T) {
+	var failures []error
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithDeadLetter(func(task core.TaskMessage, err error) {
+			failures = append(failures, err)
+		}),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, uint64(1), q.SuccessTasks())
+	assert.Equal(t, []error{ErrMissingRunFunc}, failures)
+}
+
+func TestSetRunFunc(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	handler := func(version string) func(context.Context, core.TaskMessage) error {
+		return func(ctx context.Context, m core.TaskMessage) error {
+			mu.Lock()
+			ran = append(ran, version+": "+string(m.Payload()))
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	w := NewRing(WithFn(handler("blue")))
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	assert.NoError(t, q.Queue(mockMessage{message: "foo"}))
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+
+	w.SetRunFunc(handler("green"))
+	assert.NoError(t, q.Queue(mockMessage{message: "bar"}))
+	assert.NoError(t, q.Queue(mockMessage{message: "baz"}))
+	q.Release()
+
+	assert.Equal(t, []string{"blue: foo", "green: bar", "green: baz"}, ran)
+}
+
+func TestSetRunFuncConcurrent(t *testing.T) {
+	w := NewRing(WithFn(func(ctx context.Context, m core.TaskMessage) error {
+		return nil
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, w.Run(context.Background(), mockMessage{message: "foo"}))
+		}()
+		go func() {
+			defer wg.Done()
+			w.SetRunFunc(func(ctx context.Context, m core.TaskMessage) error {
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRunWithNilRunFunc(t *testing.T) {
+	w := NewRing(WithFn(nil))
+	assert.NotPanics(t, func() {
+		assert.Equal(t, ErrMissingRunFunc, w.Run(context.Background(), &mockMessage{message: "foo"}))
+	})
+}
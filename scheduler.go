@@ -0,0 +1,113 @@
+package queue
+
+import "github.com/golang-queue/queue/core"
+
+var _ Scheduler = (*fifo)(nil)
+
+// Scheduler decides the order the Ring hands out its buffered tasks, e.g.
+// by priority or LIFO. The Ring serializes the calls, so implementations
+// don't need to be safe for concurrent use.
+type Scheduler interface {
+	// Push adds a task to the scheduler.
+	Push(task core.TaskMessage)
+	// Pop removes and returns the next task to run, it reports false when
+	// the scheduler is empty.
+	Pop() (core.TaskMessage, bool)
+	// Tasks returns the tasks in the order Pop hands them out, without
+	// removing them.
+	Tasks() []core.TaskMessage
+	// Filter removes the tasks keep rejects and leaves the others in place.
+	// It visits the tasks in the order they were pushed, or in any order
+	// that gives the current one back when they are pushed again.
+	Filter(keep func(core.TaskMessage) bool)
+}
+
+// fifo is the default Scheduler, handing out the tasks in the order they
+// were pushed from a ring buffer.
+type fifo struct {
+	tasks []core.TaskMessage // tasks holds the tasks in the ring buffer.
+	count int                // count is the current number of tasks in the buffer.
+	head  int                // head is the index of the first task in the buffer.
+	tail  int                // tail is the index where the next task will be added.
+}
+
+// newFIFO creates a fifo with a default size of 2.
+func newFIFO() *fifo {
+	return &fifo{
+		tasks: make([]core.TaskMessage, 2),
+	}
+}
+
+// Push appends task to the tail of the buffer, growing it when it is full.
+func (f *fifo) Push(task core.TaskMessage) {
+	if f.count == len(f.tasks) {
+		f.resize(f.count * 2)
+	}
+	f.tasks[f.tail] = task
+	f.tail = (f.tail + 1) % len(f.tasks)
+	f.count++
+}
+
+// Pop removes the task at the head of the buffer and shrinks it when it is
+// less than half full.
+func (f *fifo) Pop() (core.TaskMessage, bool) {
+	if f.count == 0 {
+		return nil, false
+	}
+
+	task := f.tasks[f.head]
+	f.tasks[f.head] = nil
+	f.head = (f.head + 1) % len(f.tasks)
+	f.count--
+
+	if n := len(f.tasks) / 2; n >= 2 && f.count <= n {
+		f.resize(n)
+	}
+
+	return task, true
+}
+
+// Tasks returns the tasks from the head to the tail of the buffer.
+func (f *fifo) Tasks() []core.TaskMessage {
+	tasks := make([]core.TaskMessage, 0, f.count)
+	for i := 0; i < f.count; i++ {
+		tasks = append(tasks, f.tasks[(f.head+i)%len(f.tasks)])
+	}
+	return tasks
+}
+
+// Filter moves the tasks kept towards the head of the buffer, in order.
+func (f *fifo) Filter(keep func(core.TaskMessage) bool) {
+	kept := 0
+	for i := 0; i < f.count; i++ {
+		task := f.tasks[(f.head+i)%len(f.tasks)]
+		if keep(task) {
+			f.tasks[(f.head+kept)%len(f.tasks)] = task
+			kept++
+		}
+	}
+	for i := kept; i < f.count; i++ {
+		f.tasks[(f.head+i)%len(f.tasks)] = nil
+	}
+	f.count = kept
+	f.tail = (f.head + kept) % len(f.tasks)
+}
+
+// resize adjusts the size of the ring buffer to the specified capacity n.
+// It reallocates the underlying slice to the new size and copies the existing
+// elements to the new slice in the correct order. The head and tail pointers
+// are updated accordingly to maintain the correct order of elements in the
+// resized buffer.
+func (f *fifo) resize(n int) {
+	nodes := make([]core.TaskMessage, n)
+	if f.head < f.tail {
+		copy(nodes, f.tasks[f.head:f.tail])
+	} else {
+		copy(nodes, f.tasks[f.head:])
+		copy(nodes[len(f.tasks)-f.head:], f.tasks[:f.tail])
+	}
+
+	f.tail = f.count % n
+	f.head = 0
+	f.tasks = nodes
+}
@@ -0,0 +1,236 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// shortestFirst hands out the task with the smallest payload first.
+type shortestFirst struct {
+	tasks []core.TaskMessage
+}
+
+func (s *shortestFirst) Push(task core.TaskMessage) {
+	i := sort.Search(len(s.tasks), func(i int) bool {
+		return len(s.tasks[i].Payload()) > len(task.Payload())
+	})
+	s.tasks = append(s.tasks, nil)
+	copy(s.tasks[i+1:], s.tasks[i:])
+	s.tasks[i] = task
+}
+
+func (s *shortestFirst) Pop() (core.TaskMessage, bool) {
+	if len(s.tasks) == 0 {
+		return nil, false
+	}
+	task := s.tasks[0]
+	s.tasks = s.tasks[1:]
+	return task, true
+}
+
+func (s *shortestFirst) Tasks() []core.TaskMessage {
+	return append([]core.TaskMessage(nil), s.tasks...)
+}
+
+func (s *shortestFirst) Filter(keep func(core.TaskMessage) bool) {
+	kept := s.tasks[:0]
+	for _, task := range s.tasks {
+		if keep(task) {
+			kept = append(kept, task)
+		}
+	}
+	s.tasks = kept
+}
+
+// lifo hands out the task pushed last first.
+type lifo struct {
+	tasks []core.TaskMessage
+}
+
+func (s *lifo) Push(task core.TaskMessage) {
+	s.tasks = append(s.tasks, task)
+}
+
+func (s *lifo) Pop() (core.TaskMessage, bool) {
+	if len(s.tasks) == 0 {
+		return nil, false
+	}
+	task := s.tasks[len(s.tasks)-1]
+	s.tasks = s.tasks[:len(s.tasks)-1]
+	return task, true
+}
+
+func (s *lifo) Tasks() []core.TaskMessage {
+	tasks := make([]core.TaskMessage, 0, len(s.tasks))
+	for i := len(s.tasks) - 1; i >= 0; i-- {
+		tasks = append(tasks, s.tasks[i])
+	}
+	return tasks
+}
+
+func (s *lifo) Filter(keep func(core.TaskMessage) bool) {
+	kept := s.tasks[:0]
+	for _, task := range s.tasks {
+		if keep(task) {
+			kept = append(kept, task)
+		}
+	}
+	s.tasks = kept
+}
+
+func TestFIFO(t *testing.T) {
+	f := newFIFO()
+	_, ok := f.Pop()
+	assert.False(t, ok)
+
+	// wrap around the buffer while it grows and shrinks
+	next := 0
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 5; i++ {
+			f.Push(&mockMessage{message: string(rune('a' + next + i))})
+		}
+		for i := 0; i < 5; i++ {
+			task, ok := f.Pop()
+			assert.True(t, ok)
+			assert.Equal(t, string(rune('a'+next+i)), string(task.Payload()))
+		}
+		next += 5
+	}
+	_, ok = f.Pop()
+	assert.False(t, ok)
+}
+
+func TestFIFOFilter(t *testing.T) {
+	f := newFIFO()
+	// wrap the buffer around its end
+	for _, body := range []string{"x", "y", "a", "b", "c"} {
+		f.Push(&mockMessage{message: body})
+	}
+	f.Pop()
+	f.Pop()
+	f.Push(&mockMessage{message: "d"})
+	f.Push(&mockMessage{message: "e"})
+
+	f.Filter(func(task core.TaskMessage) bool {
+		return string(task.Payload()) != "b" && string(task.Payload()) != "d"
+	})
+	var got []string
+	for _, task := range f.Tasks() {
+		got = append(got, string(task.Payload()))
+	}
+	assert.Equal(t, []string{"a", "c", "e"}, got)
+
+	f.Push(&mockMessage{message: "f"})
+	got = nil
+	for {
+		task, ok := f.Pop()
+		if !ok {
+			break
+		}
+		got = append(got, string(task.Payload()))
+	}
+	assert.Equal(t, []string{"a", "c", "e", "f"}, got)
+}
+
+func TestRingSchedulerLIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	payloads := func(tasks []core.QueuedMessage) []string {
+		got := make([]string, 0, len(tasks))
+		for _, task := range tasks {
+			got = append(got, string(task.(core.TaskMessage).Payload()))
+		}
+		return got
+	}
+
+	w := NewRing(WithScheduler(&lifo{}), WithPersistence(path))
+	for _, body := range []string{"a", "b", "c", "d"} {
+		m := job.NewMessage(&mockMessage{message: body}, job.AllowOption{ID: job.String(body)})
+		assert.NoError(t, w.Queue(&m))
+	}
+
+	// peeking twice doesn't change the order
+	assert.Equal(t, []string{"d", "c", "b", "a"}, payloads(w.Peek()))
+	assert.Equal(t, []string{"d", "c", "b", "a"}, payloads(w.Peek()))
+
+	_, ok := w.Remove("c")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"d", "b", "a"}, payloads(w.Peek()))
+
+	// the order survives a restart
+	assert.NoError(t, w.Shutdown())
+	w = NewRing(WithScheduler(&lifo{}), WithPersistence(path))
+	assert.Equal(t, []string{"d", "b", "a"}, payloads(w.Peek()))
+	for _, want := range []string{"d", "b", "a"} {
+		task, err := w.Request()
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(task.Payload()))
+	}
+	assert.NoError(t, w.Shutdown())
+}
+
+func TestRingScheduler(t *testing.T) {
+	w := NewRing(WithScheduler(&shortestFirst{}))
+	for _, body := range []string{"ccc", "a", "dddd", "bb"} {
+		assert.NoError(t, w.Queue(&mockMessage{message: body}))
+	}
+	assert.Equal(t, 4, w.Usage())
+
+	var peeked []string
+	for _, task := range w.Peek() {
+		peeked = append(peeked, string(task.Bytes()))
+	}
+	assert.Equal(t, []string{"a", "bb", "ccc", "dddd"}, peeked)
+
+	m := job.NewMessage(&mockMessage{message: "eeeee"}, job.AllowOption{ID: job.String("e")})
+	assert.NoError(t, w.Queue(&m))
+	removed, ok := w.Remove("e")
+	assert.True(t, ok)
+	assert.Equal(t, &m, removed)
+	assert.Equal(t, 4, w.Usage())
+
+	task, err := w.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(task.Payload()))
+	tasks, err := w.RequestBatch(3)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 3)
+	assert.Equal(t, "bb", string(tasks[0].Payload()))
+	assert.Equal(t, "dddd", string(tasks[2].Payload()))
+	_, err = w.Request()
+	assert.Equal(t, ErrNoTaskInQueue, err)
+}
+
+func TestQueueWithScheduler(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	q, err := NewQueue(
+		WithWorker(NewRing(
+			WithScheduler(&shortestFirst{}),
+			WithFn(func(ctx context.Context, m core.TaskMessage) error {
+				mu.Lock()
+				order = append(order, string(m.Payload()))
+				mu.Unlock()
+				return nil
+			}),
+		)),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	for _, body := range []string{"ccc", "a", "dddd", "bb"} {
+		assert.NoError(t, q.Queue(mockMessage{message: body}))
+	}
+	assert.NoError(t, q.Start())
+	q.Release()
+
+	assert.Equal(t, []string{"a", "bb", "ccc", "dddd"}, order)
+}
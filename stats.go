@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang-queue/queue/core"
+)
+
+// Stats is a snapshot of the queue counters, as served by StatsHandler.
+type Stats struct {
+	BusyWorkers    int64   `json:"busy_workers"`
+	SuccessTasks   uint64  `json:"success_tasks"`
+	FailureTasks   uint64  `json:"failure_tasks"`
+	SubmittedTasks uint64  `json:"submitted_tasks"`
+	Capacity       int     `json:"capacity"` // zero without limit, -1 if unknown
+	Usage          int     `json:"usage"`    // -1 if unknown
+	Throughput     float64 `json:"throughput"`
+}
+
+// Stats returns a snapshot of the queue counters.
+func (q *Queue) Stats() Stats {
+	capacity := -1
+	if c, ok := q.worker.(core.CapacityReporter); ok {
+		capacity = c.Capacity()
+	}
+
+	return Stats{
+		BusyWorkers:    q.BusyWorkers(),
+		SuccessTasks:   q.SuccessTasks(),
+		FailureTasks:   q.FailureTasks(),
+		SubmittedTasks: q.SubmittedTasks(),
+		Capacity:       capacity,
+		Usage:          q.Len(),
+		Throughput:     q.Throughput(),
+	}
+}
+
+// StatsHandler returns an http.Handler serving the Stats of q as JSON on GET.
+func StatsHandler(q *Queue) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(q.Stats()); err != nil {
+			q.logger.Errorf("write stats: %s", err.Error())
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsHandler(t *testing.T) {
+	w := NewRing(WithQueueSize(10))
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return errors.New("failed")
+	}))
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.CompletedTasks() == 2
+	}, time.Second, time.Millisecond)
+
+	// keep a job running and another one buffered
+	release := make(chan struct{})
+	started := make(chan struct{})
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}))
+	<-started
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+
+	srv := httptest.NewServer(StatsHandler(q))
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(srv.URL)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+			var stats map[string]interface{}
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+			assert.Equal(t, 1.0, stats["busy_workers"])
+			assert.Equal(t, 1.0, stats["success_tasks"])
+			assert.Equal(t, 1.0, stats["failure_tasks"])
+			assert.Equal(t, 4.0, stats["submitted_tasks"])
+			assert.Equal(t, 10.0, stats["capacity"])
+			assert.Equal(t, 1.0, stats["usage"])
+			assert.Greater(t, stats["throughput"], 0.0)
+		}()
+	}
+	wg.Wait()
+
+	resp, err := http.Post(srv.URL, "application/json", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	close(release)
+	q.Release()
+}
@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"container/list"
+	"sync"
+)
+
+// JobStatus describes where a job is in its lifecycle.
+type JobStatus int
+
+const (
+	// JobPending the job is queued and waits for a worker.
+	JobPending JobStatus = iota
+	// JobRunning the job is being handled by a worker.
+	JobRunning
+	// JobSucceeded the job finished without error.
+	JobSucceeded
+	// JobFailed the job finished with an error or a panic.
+	JobFailed
+)
+
+var defaultStatusCapacity = 1024
+
+// activeStatusFactor bounds the pending and running jobs tracked to this
+// many times the status capacity.
+const activeStatusFactor = 64
+
+// String returns the name of the status.
+func (s JobStatus) String() string {
+	switch s {
+	case JobPending:
+		return "pending"
+	case JobRunning:
+		return "running"
+	case JobSucceeded:
+		return "succeeded"
+	case JobFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+type statusEntry struct {
+	id     string
+	status JobStatus
+}
+
+// statusTracker records the status of jobs by ID. Pending and running jobs
+// are kept until they finish, up to activeStatusFactor times the capacity,
+// after which the oldest are forgotten; finished jobs are kept in a bounded
+// LRU so memory does not grow with the number of submitted jobs.
+type statusTracker struct {
+	sync.Mutex
+	capacity int
+	active   map[string]*list.Element
+	queued   *list.List // active jobs, oldest first
+	finished map[string]*list.Element
+	order    *list.List
+}
+
+func newStatusTracker(capacity int) *statusTracker {
+	if capacity <= 0 {
+		capacity = defaultStatusCapacity
+	}
+	return &statusTracker{
+		capacity: capacity,
+		active:   make(map[string]*list.Element),
+		queued:   list.New(),
+		finished: make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// set records status for id.
+func (t *statusTracker) set(id string, status JobStatus) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.removeFinished(id)
+	if status == JobPending || status == JobRunning {
+		if e, ok := t.active[id]; ok {
+			e.Value.(*statusEntry).status = status
+			return
+		}
+		t.active[id] = t.queued.PushBack(&statusEntry{id: id, status: status})
+		// jobs that never report back, e.g. left in the worker, go first
+		if t.queued.Len() > t.capacity*activeStatusFactor {
+			t.removeActive(t.queued.Front().Value.(*statusEntry).id)
+		}
+		return
+	}
+
+	t.removeActive(id)
+	t.finished[id] = t.order.PushFront(&statusEntry{id: id, status: status})
+	if t.order.Len() > t.capacity {
+		t.removeFinished(t.order.Back().Value.(*statusEntry).id)
+	}
+}
+
+// remove forgets id.
+func (t *statusTracker) remove(id string) {
+	t.Lock()
+	t.removeActive(id)
+	t.removeFinished(id)
+	t.Unlock()
+}
+
+// get returns the status recorded for id.
+func (t *statusTracker) get(id string) (JobStatus, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if e, ok := t.active[id]; ok {
+		return e.Value.(*statusEntry).status, true
+	}
+	if e, ok := t.finished[id]; ok {
+		t.order.MoveToFront(e)
+		return e.Value.(*statusEntry).status, true
+	}
+	return 0, false
+}
+
+func (t *statusTracker) removeActive(id string) {
+	if e, ok := t.active[id]; ok {
+		t.queued.Remove(e)
+		delete(t.active, id)
+	}
+}
+
+func (t *statusTracker) removeFinished(id string) {
+	if e, ok := t.finished[id]; ok {
+		t.order.Remove(e)
+		delete(t.finished, id)
+	}
+}
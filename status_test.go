@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusTrackerCapacity(t *testing.T) {
+	s := newStatusTracker(2)
+	s.set("a", JobSucceeded)
+	s.set("b", JobFailed)
+	s.set("c", JobSucceeded)
+
+	_, ok := s.get("a")
+	assert.False(t, ok)
+	status, ok := s.get("b")
+	assert.True(t, ok)
+	assert.Equal(t, JobFailed, status)
+	assert.Len(t, s.finished, 2)
+
+	// running jobs are not evicted by finished ones
+	s.set("d", JobRunning)
+	s.set("e", JobSucceeded)
+	status, ok = s.get("d")
+	assert.True(t, ok)
+	assert.Equal(t, JobRunning, status)
+}
+
+func TestStatusTrackerActiveCapacity(t *testing.T) {
+	s := newStatusTracker(1)
+	for i := 0; i < activeStatusFactor; i++ {
+		s.set(fmt.Sprint(i), JobPending)
+	}
+	// updating a job keeps its place
+	s.set("0", JobRunning)
+
+	// the oldest job is forgotten once the bound is reached
+	s.set("new", JobPending)
+	assert.Len(t, s.active, activeStatusFactor)
+	_, ok := s.get("0")
+	assert.False(t, ok)
+	status, ok := s.get("new")
+	assert.True(t, ok)
+	assert.Equal(t, JobPending, status)
+
+	// finished jobs leave the active ones
+	s.set("new", JobSucceeded)
+	assert.Len(t, s.active, activeStatusFactor-1)
+	assert.Equal(t, activeStatusFactor-1, s.queued.Len())
+}
+
+func TestQueueStatus(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	_, ok := q.Status("unknown")
+	assert.False(t, ok)
+
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, job.AllowOption{ID: job.String("ok")}))
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return errors.New("failed")
+	}, job.AllowOption{ID: job.String("fail")}))
+
+	status, ok := q.Status("ok")
+	assert.True(t, ok)
+	assert.Equal(t, JobPending, status)
+
+	assert.NoError(t, q.Start())
+	<-started
+	status, _ = q.Status("ok")
+	assert.Equal(t, JobRunning, status)
+	status, _ = q.Status("fail")
+	assert.Equal(t, JobPending, status)
+
+	close(release)
+	q.Release()
+
+	status, _ = q.Status("ok")
+	assert.Equal(t, JobSucceeded, status)
+	status, _ = q.Status("fail")
+	assert.Equal(t, JobFailed, status)
+	assert.Equal(t, "failed", status.String())
+}
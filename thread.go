@@ -3,22 +3,102 @@ package queue
 import "sync"
 
 type routineGroup struct {
-	waitGroup sync.WaitGroup
+	mu      sync.Mutex
+	running int
+	idle    chan struct{} // closed once running drops to zero
 }
 
 func newRoutineGroup() *routineGroup {
-	return new(routineGroup)
+	idle := make(chan struct{})
+	close(idle)
+	return &routineGroup{idle: idle}
 }
 
 func (g *routineGroup) Run(fn func()) {
-	g.waitGroup.Add(1)
+	g.mu.Lock()
+	if g.running == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.running++
+	g.mu.Unlock()
 
 	go func() {
-		defer g.waitGroup.Done()
+		defer g.exit()
 		fn()
 	}()
 }
 
+// exit records that a function has returned.
+func (g *routineGroup) exit() {
+	g.mu.Lock()
+	g.running--
+	if g.running == 0 {
+		close(g.idle)
+	}
+	g.mu.Unlock()
+}
+
 func (g *routineGroup) Wait() {
-	g.waitGroup.Wait()
+	<-g.done()
+}
+
+// done returns a channel closed once all the functions have returned.
+func (g *routineGroup) done() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.idle
+}
+
+// goroutinePool runs functions on a fixed set of reusable goroutines and
+// falls back to a new goroutine when all of them are busy, so callers are
+// never blocked waiting for an idle one.
+type goroutinePool struct {
+	fns   chan func()
+	ready sync.WaitGroup
+}
+
+func newGoroutinePool() *goroutinePool {
+	return &goroutinePool{
+		fns: make(chan func()),
+	}
+}
+
+// start launches size goroutines that serve the pool until quit is closed.
+// They are not waited for, like the goroutines started by Go, so that a job
+// ignoring its timeout can't hold up a shutdown.
+func (p *goroutinePool) start(size int, quit <-chan struct{}) {
+	p.ready.Add(size)
+	for i := 0; i < size; i++ {
+		go func() {
+			p.ready.Done()
+			for {
+				select {
+				case fn := <-p.fns:
+					fn()
+				case <-quit:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// wait blocks until the goroutines launched by start are serving the pool.
+func (p *goroutinePool) wait() {
+	p.ready.Wait()
+}
+
+// Go runs fn on an idle pool goroutine, or on a new one if there is none.
+// fn must recover its own panics since pool goroutines are shared.
+func (p *goroutinePool) Go(fn func()) {
+	if p == nil {
+		go fn()
+		return
+	}
+
+	select {
+	case p.fns <- fn:
+	default:
+		go fn()
+	}
 }
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutineGroupDone(t *testing.T) {
+	g := newRoutineGroup()
+	select {
+	case <-g.done():
+	default:
+		t.Fatal("done is not closed without functions")
+	}
+
+	release := make(chan struct{})
+	g.Run(func() { <-release })
+	g.Run(func() { <-release })
+	// waiting spawns nothing, every caller gets the same channel
+	before := runtime.NumGoroutine()
+	done := g.done()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, done, g.done())
+	}
+	assert.Equal(t, before, runtime.NumGoroutine())
+	select {
+	case <-done:
+		t.Fatal("done is closed while functions run")
+	default:
+	}
+
+	close(release)
+	<-done
+	g.Wait()
+}
+
+func TestGoroutinePoolFallback(t *testing.T) {
+	quit := make(chan struct{})
+	p := newGoroutinePool()
+	p.start(1, quit)
+	defer close(quit)
+
+	// the single pool goroutine is busy, the second function still runs
+	release := make(chan struct{})
+	done := make(chan struct{}, 2)
+	p.Go(func() {
+		<-release
+		done <- struct{}{}
+	})
+	p.Go(func() {
+		done <- struct{}{}
+	})
+	<-done
+	close(release)
+	<-done
+}
+
+func TestHandlerPoolUnderLoad(t *testing.T) {
+	total := 500
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(16),
+		WithHandlerPool(4),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	var ran int32
+	for i := 0; i < total; i++ {
+		i := i
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			atomic.AddInt32(&ran, 1)
+			switch i % 10 {
+			case 0:
+				panic("boom")
+			case 1:
+				return errors.New("failed")
+			case 2:
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}, job.AllowOption{Timeout: job.Time(10 * time.Millisecond)}))
+	}
+	assert.NoError(t, q.Start())
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks()+q.FailureTasks() == uint64(total)
+	}, 5*time.Second, 5*time.Millisecond)
+	q.Release()
+
+	assert.Equal(t, int32(total), atomic.LoadInt32(&ran))
+	assert.Equal(t, uint64(total*7/10), q.SuccessTasks())
+	assert.Equal(t, uint64(total*3/10), q.FailureTasks())
+}
+
+func benchmarkHandle(b *testing.B, opts ...Option) {
+	q, _ := NewQueue(append([]Option{
+		WithWorker(NewRing()),
+		WithLogger(emptyLogger{}),
+	}, opts...)...)
+	_ = q.Start()
+	defer q.Release()
+
+	task := job.Message{
+		Timeout: 100 * time.Millisecond,
+		Task: func(_ context.Context) error {
+			return nil
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_ = q.run(context.Background(), &task)
+	}
+}
+
+func BenchmarkHandleGoroutinePerJob(b *testing.B) {
+	benchmarkHandle(b)
+}
+
+func BenchmarkHandleGoroutinePool(b *testing.B) {
+	benchmarkHandle(b, WithHandlerPool(runtime.NumCPU()))
+}
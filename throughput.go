@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// throughputBuckets is the number of slices the throughput window is split
+// into, the oldest one is discarded as the window moves.
+const throughputBuckets = 20
+
+// throughput counts the completed jobs over a sliding window.
+type throughput struct {
+	sync.Mutex
+	clock  Clock
+	slot   time.Duration
+	first  time.Time                 // first is the time of the first completion
+	counts [throughputBuckets]uint64 // counts are the completions per slot
+	slots  [throughputBuckets]int64  // slots are the slot numbers the counts belong to
+}
+
+func newThroughput(clock Clock, window time.Duration) *throughput {
+	slot := window / throughputBuckets
+	if slot <= 0 {
+		slot = 1
+	}
+	return &throughput{
+		clock: clock,
+		slot:  slot,
+	}
+}
+
+// record counts a completion at the current time.
+func (t *throughput) record() {
+	now := t.clock.Now()
+	n := now.UnixNano() / int64(t.slot)
+	i := n % throughputBuckets
+
+	t.Lock()
+	defer t.Unlock()
+	if t.first.IsZero() {
+		t.first = now
+	}
+	if t.slots[i] != n {
+		t.slots[i] = n
+		t.counts[i] = 0
+	}
+	t.counts[i]++
+}
+
+// rate returns the completions per second over the window, or since the
+// first completion when it is more recent.
+func (t *throughput) rate() float64 {
+	now := t.clock.Now()
+	n := now.UnixNano() / int64(t.slot)
+
+	t.Lock()
+	defer t.Unlock()
+	if t.first.IsZero() {
+		return 0
+	}
+
+	var total uint64
+	for i, slot := range t.slots {
+		if slot > n-throughputBuckets && slot <= n {
+			total += t.counts[i]
+		}
+	}
+
+	// the current slot is only partly elapsed
+	elapsed := time.Duration(throughputBuckets-1)*t.slot + now.Sub(time.Unix(0, n*int64(t.slot)))
+	if since := now.Sub(t.first); since < elapsed {
+		elapsed = since
+	}
+	if elapsed < t.slot {
+		elapsed = t.slot
+	}
+	return float64(total) / elapsed.Seconds()
+}
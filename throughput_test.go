@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughputRate(t *testing.T) {
+	clock := newFakeClock()
+	tp := newThroughput(clock, 10*time.Second)
+	assert.Equal(t, 0.0, tp.rate())
+
+	// 5 jobs per second for 20 seconds
+	for i := 0; i < 100; i++ {
+		tp.record()
+		clock.Advance(200 * time.Millisecond)
+	}
+	assert.InDelta(t, 5.0, tp.rate(), 0.5)
+
+	// the rate halves when the cadence does
+	for i := 0; i < 50; i++ {
+		tp.record()
+		clock.Advance(400 * time.Millisecond)
+	}
+	assert.InDelta(t, 2.5, tp.rate(), 0.3)
+
+	// and decays once nothing completes anymore
+	clock.Advance(5 * time.Second)
+	assert.InDelta(t, 1.25, tp.rate(), 0.3)
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, 0.0, tp.rate())
+}
+
+func TestThroughputSinceFirstCompletion(t *testing.T) {
+	clock := newFakeClock()
+	tp := newThroughput(clock, 10*time.Second)
+
+	// a queue running for less than the window isn't averaged over all of it
+	for i := 0; i < 20; i++ {
+		tp.record()
+		clock.Advance(100 * time.Millisecond)
+	}
+	assert.InDelta(t, 10.0, tp.rate(), 1)
+}
+
+func TestQueueThroughput(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithThroughputWindow(time.Second),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, q.Throughput())
+	assert.NoError(t, q.Start())
+
+	// about 50 jobs per second
+	for i := 0; i < 25; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			return nil
+		}))
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.InDelta(t, 50.0, q.Throughput(), 20)
+	q.Release()
+}
@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"sync/atomic"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+)
+
+// topicGate holds back the jobs of paused topics.
+type topicGate struct {
+	paused  map[string][]core.TaskMessage // paused topic -> jobs the worker didn't take back
+	resumed []core.TaskMessage            // held jobs of resumed topics, started first
+}
+
+func newTopicGate() *topicGate {
+	return &topicGate{
+		paused: make(map[string][]core.TaskMessage),
+	}
+}
+
+// PauseTopic stops starting the jobs tagged with the topic, see
+// job.AllowOption.Topic. Jobs of other topics keep running. Jobs of the
+// topic requested from the worker are queued to it again and stay buffered
+// there until ResumeTopic, the queue waits for the next poll when it got
+// nothing else. The ones the worker doesn't take back, e.g. because it is
+// full or read-only, are held by the queue and started first on resume.
+// Running jobs are not interrupted.
+func (q *Queue) PauseTopic(topic string) {
+	q.Lock()
+	defer q.Unlock()
+	if _, ok := q.topics.paused[topic]; !ok {
+		q.topics.paused[topic] = nil
+	}
+}
+
+// ResumeTopic starts the jobs of a paused topic again, the ones buffered by
+// the worker as they are requested and the ones held by the queue before
+// any other.
+func (q *Queue) ResumeTopic(topic string) {
+	q.Lock()
+	held, ok := q.topics.paused[topic]
+	delete(q.topics.paused, topic)
+	q.topics.resumed = append(q.topics.resumed, held...)
+	interrupt := q.interrupt
+	q.Unlock()
+
+	// stop waiting for the worker to start the held jobs
+	if len(held) > 0 && interrupt != nil {
+		interrupt()
+	}
+	// and poll it at once for the jobs it buffered
+	if ok {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// TopicPaused reports whether the topic is paused.
+func (q *Queue) TopicPaused(topic string) bool {
+	q.Lock()
+	defer q.Unlock()
+	_, ok := q.topics.paused[topic]
+	return ok
+}
+
+// hold keeps the task back when its topic is paused and reports whether
+// it did. The job is queued to the worker again, as reported by handedBack,
+// or held by the queue when the worker doesn't take it.
+func (q *Queue) hold(task core.TaskMessage) (held, handedBack bool) {
+	m, ok := task.(*job.Message)
+	if !ok || m.Topic == "" || !q.TopicPaused(m.Topic) {
+		return false, false
+	}
+
+	err := q.handBack(m)
+	if err == nil {
+		q.debugf("job %q handed back, topic %q is paused", m.ID, m.Topic)
+		return true, true
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	tasks, ok := q.topics.paused[m.Topic]
+	if !ok {
+		// resumed in the meantime
+		q.topics.resumed = append(q.topics.resumed, task)
+		return true, false
+	}
+	q.topics.paused[m.Topic] = append(tasks, task)
+	q.debugf("job %q held, topic %q is paused: %s", m.ID, m.Topic, err.Error())
+	return true, false
+}
+
+// handBack queues a job requested from the worker to it again. Unlike a
+// submission it keeps the time the job was enqueued at and isn't counted.
+func (q *Queue) handBack(m *job.Message) error {
+	q.submit.RLock()
+	defer q.submit.RUnlock()
+	if atomic.LoadInt32(&q.stopFlag) == 1 {
+		return ErrQueueShutdown
+	}
+	// settled before it can be handed out again
+	q.finish(m, nil)
+	return q.pusher(m)(m)
+}
+
+// unheld returns the tasks hold doesn't keep back, and the number of the
+// held ones queued to the worker again.
+func (q *Queue) unheld(tasks []core.TaskMessage) ([]core.TaskMessage, int) {
+	kept := tasks[:0]
+	handedBack := 0
+	for _, task := range tasks {
+		held, back := q.hold(task)
+		if !held {
+			kept = append(kept, task)
+		}
+		if back {
+			handedBack++
+		}
+	}
+	return kept, handedBack
+}
+
+// resumed takes up to n of the held jobs of resumed topics.
+func (q *Queue) resumed(n int) []core.TaskMessage {
+	q.Lock()
+	defer q.Unlock()
+	if n > len(q.topics.resumed) {
+		n = len(q.topics.resumed)
+	}
+	if n == 0 {
+		return nil
+	}
+	tasks := append([]core.TaskMessage(nil), q.topics.resumed[:n]...)
+	q.topics.resumed = q.topics.resumed[n:]
+	return tasks
+}
+
+// dropHeld discards the jobs held by the queue at shutdown, their waiters
+// get ErrQueueShutdown. It returns the number of jobs dropped.
+func (q *Queue) dropHeld() int {
+	q.Lock()
+	paused := q.topics.paused
+	q.topics.paused = make(map[string][]core.TaskMessage)
+	resumed := q.topics.resumed
+	q.topics.resumed = nil
+	q.Unlock()
+
+	dropped := 0
+	drop := func(held []core.TaskMessage) {
+		for _, task := range held {
+			q.setStatus(task, JobFailed)
+			q.finish(task, ErrQueueShutdown)
+			q.notify(task, ErrQueueShutdown)
+		}
+		dropped += len(held)
+	}
+	for topic, held := range paused {
+		if len(held) > 0 {
+			q.logger.Infof("drop %d jobs of paused topic %q", len(held), topic)
+		}
+		drop(held)
+	}
+	if len(resumed) > 0 {
+		q.logger.Infof("drop %d jobs of resumed topics", len(resumed))
+	}
+	drop(resumed)
+	return dropped
+}
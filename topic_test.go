@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-queue/queue/core"
+	"github.com/golang-queue/queue/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseTopic(t *testing.T) {
+	var mu sync.Mutex
+	ran := make(map[string]int)
+	task := func(topic string) job.TaskFunc {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			ran[topic]++
+			mu.Unlock()
+			return nil
+		}
+	}
+	count := func(topic string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return ran[topic]
+	}
+
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(2),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	q.PauseTopic("mail")
+	assert.True(t, q.TopicPaused("mail"))
+	assert.False(t, q.TopicPaused("billing"))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, q.QueueTask(task("mail"), job.AllowOption{Topic: job.String("mail")}))
+		assert.NoError(t, q.QueueTask(task("billing"), job.AllowOption{Topic: job.String("billing")}))
+		assert.NoError(t, q.QueueTask(task("")))
+	}
+	assert.NoError(t, q.Start())
+
+	assert.Eventually(t, func() bool {
+		return count("billing") == 3 && count("") == 3
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, count("mail"))
+
+	q.ResumeTopic("mail")
+	assert.False(t, q.TopicPaused("mail"))
+	assert.Eventually(t, func() bool {
+		return count("mail") == 3
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, uint64(9), q.SuccessTasks())
+	q.Release()
+}
+
+func TestPauseTopicShutdown(t *testing.T) {
+	q, err := NewQueue(
+		WithWorker(NewRing()),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	q.PauseTopic("mail")
+	done := make(chan error, 1)
+	go func() {
+		done <- q.QueueTaskAndWait(context.Background(), func(ctx context.Context) error {
+			return nil
+		}, job.AllowOption{Topic: job.String("mail")})
+	}()
+
+	// the job is held, the waiter learns it is dropped at shutdown
+	time.Sleep(50 * time.Millisecond)
+	q.Release()
+	assert.Equal(t, ErrQueueShutdown, <-done)
+	assert.Equal(t, uint64(0), q.SuccessTasks())
+	assert.Equal(t, 1, q.Unprocessed())
+}
+
+func TestPauseTopicKeepsJobsInWorker(t *testing.T) {
+	var ran int32
+	w := NewRing()
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+
+	q.PauseTopic("mail")
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		}, job.AllowOption{Topic: job.String("mail")}))
+	}
+	assert.NoError(t, q.QueueTask(func(ctx context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, q.Start())
+
+	// the jobs of the paused topic stay buffered in the worker
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 2, w.Usage())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ran))
+	assert.Equal(t, uint64(3), q.SubmittedTasks())
+
+	q.ResumeTopic("mail")
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 0, w.Usage())
+	q.Release()
+}
+
+func TestPauseTopicReadOnlyWorker(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []string
+	ch := make(chan core.QueuedMessage, 2)
+	w := NewChannelWorker(ch, WithFn(func(ctx context.Context, m core.TaskMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		payloads = append(payloads, string(m.Payload()))
+		return nil
+	}))
+	q, err := NewQueue(
+		WithWorker(w),
+		WithWorkerCount(1),
+		WithLogger(NewEmptyLogger()),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Start())
+
+	// the worker can't take the job back, the queue holds it instead
+	q.PauseTopic("mail")
+	m := job.NewMessage(mockMessage{message: "mail"}, job.AllowOption{Topic: job.String("mail")})
+	ch <- &m
+	ch <- mockMessage{message: "other"}
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(0), q.FailureTasks())
+
+	q.ResumeTopic("mail")
+	assert.Eventually(t, func() bool {
+		return q.SuccessTasks() == 2
+	}, time.Second, time.Millisecond)
+	q.Release()
+	assert.Equal(t, []string{"other", "mail"}, payloads)
+}